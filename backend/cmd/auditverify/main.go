@@ -0,0 +1,46 @@
+// Command auditverify checks the audit_log hash chain end to end.
+// Exits 1 if any row was modified, deleted or reordered.
+//
+// The chain cannot show rows deleted from its end by itself. Keep the head it prints somewhere
+// outside the database and pass it with -head on the next run.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/db"
+)
+
+func main() {
+	head := flag.String("head", "", "head printed by an earlier run; fails if it is no longer in the chain")
+	flag.Parse()
+
+	_ = godotenv.Load()
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL is missing")
+	}
+
+	ctx := context.Background()
+	sqlDB, err := db.Open(ctx, databaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	res, err := audit.Verify(ctx, sqlDB, *head)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(res)
+	if res.Problem != "" {
+		os.Exit(1)
+	}
+}
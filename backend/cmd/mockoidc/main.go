@@ -0,0 +1,187 @@
+// Command mockoidc is a local OIDC issuer for exercising the social login flow
+// without Google or Microsoft. It auto-approves every authorization request.
+//
+//	go run ./cmd/mockoidc -addr :9400
+//	OIDC_PROVIDERS=mock OIDC_MOCK_ISSUER=http://localhost:9400 OIDC_MOCK_CLIENT_ID=local ...
+//
+// The signed-in identity is taken from ?login_hint=<email> on the authorize URL.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const kid = "mock-1"
+
+type grant struct {
+	clientID  string
+	challenge string
+	nonce     string
+	email     string
+	expires   time.Time
+}
+
+type issuer struct {
+	url  string
+	key  *rsa.PrivateKey
+	mu   sync.Mutex
+	code map[string]grant
+}
+
+func main() {
+	addr := flag.String("addr", ":9400", "listen address")
+	issuerURL := flag.String("issuer", "http://localhost:9400", "issuer URL as seen by the backend")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	iss := &issuer{url: *issuerURL, key: key, code: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("GET /jwks", iss.jwks)
+	mux.HandleFunc("GET /authorize", iss.authorize)
+	mux.HandleFunc("POST /token", iss.token)
+
+	log.Printf("mock OIDC issuer %s listening on %s", *issuerURL, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (i *issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"issuer":                                i.url,
+		"authorization_endpoint":                i.url + "/authorize",
+		"token_endpoint":                        i.url + "/token",
+		"jwks_uri":                              i.url + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := i.key.PublicKey
+	writeJSON(w, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (i *issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "only code flow with PKCE S256 is supported", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	email := q.Get("login_hint")
+	if email == "" {
+		email = "mock.user@example.com"
+	}
+
+	code := randomString()
+	i.mu.Lock()
+	i.code[code] = grant{
+		clientID:  q.Get("client_id"),
+		challenge: q.Get("code_challenge"),
+		nonce:     q.Get("nonce"),
+		email:     email,
+		expires:   time.Now().Add(time.Minute),
+	}
+	i.mu.Unlock()
+
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.code[r.PostForm.Get("code")]
+	delete(i.code, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(g.expires):
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		http.Error(w, `{"error":"invalid_grant","error_description":"pkce"}`, http.StatusBadRequest)
+		return
+	case r.PostForm.Get("client_id") != g.clientID:
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// Stable subject per email so repeated logins hit the same identity
+	subSum := sha256.Sum256([]byte(g.email))
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            i.url,
+		"aud":            g.clientID,
+		"sub":            "mock-" + hex.EncodeToString(subSum[:8]),
+		"email":          g.email,
+		"email_verified": true,
+		"name":           "Mock User",
+		"nonce":          g.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	t.Header["kid"] = kid
+	idToken, err := t.SignedString(i.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/admin"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/auth"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/health"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/oidcauth"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/opconnect"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/openapi"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/user"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/wellknown"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/certs"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/config"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/notify"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oidc"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opclient"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oprecord"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/password"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/ratelimit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/tracing"
+)
+
+// app is the wired API: the handler of the public listener, and what main runs and drains
+// around it
+type app struct {
+	handler http.Handler
+	health  *health.Handler
+	certs   *certs.Manager
+	privacy *service.PrivacyService
+}
+
+// newApp builds services, handlers and routes on sqlDB. The certificate manager is not
+// running yet; main starts it.
+func newApp(cfg config.Config, sqlDB *sql.DB) (*app, error) {
+	// Brute-force limiter backend: postgres shares counters across instances
+	var throttle ratelimit.Store
+	switch cfg.AuthLimiterBackend {
+	case "memory":
+		throttle = ratelimit.NewMemoryStore(24 * time.Hour)
+	case "postgres":
+		throttle = ratelimit.NewPostgresStore(sqlDB)
+	default:
+		return nil, fmt.Errorf("unknown AUTH_LIMITER_BACKEND %q", cfg.AuthLimiterBackend)
+	}
+
+	// Password policy (breached-password check only when range files are provided)
+	var breached *password.BreachChecker
+	if cfg.PasswordBreachDir != "" {
+		breached = password.NewBreachChecker(cfg.PasswordBreachDir, cfg.PasswordBreachMinCount)
+	}
+	pwPolicy := password.NewPolicy(cfg.PasswordMinLength, cfg.PasswordMaxLength, breached)
+
+	// Audit log: hash chained, shared by auth, opconnect and admin
+	auditRecorder := audit.NewRecorder(sqlDB)
+
+	// Auth / User
+	userRepo := repo.NewUserRepo(sqlDB)
+	resetRepo := repo.NewPasswordResetRepo(sqlDB)
+	sessionRepo := repo.NewSessionRepo(sqlDB)
+	signInRepo := repo.NewSignInEventRepo(sqlDB)
+	authSvc, err := service.NewAuthService(
+		userRepo,
+		resetRepo,
+		sessionRepo,
+		signInRepo,
+		auditRecorder,
+		cfg.JWTSecret,
+		throttle,
+		notify.LogNotifier{},
+		pwPolicy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	verificationRepo := repo.NewEmailVerificationRepo(sqlDB)
+	userSvc := service.NewUserService(userRepo, verificationRepo, notify.LogNotifier{}, auditRecorder, authSvc)
+	// Cookie session mode: tokens in HttpOnly cookies, Secure unless served over plain HTTP
+	sessionCookies := middleware.SessionCookies{
+		Enabled:  cfg.SessionMode == "cookie",
+		Secure:   strings.HasPrefix(cfg.PublicBaseURL, "https://"),
+		SameSite: map[string]http.SameSite{"strict": http.SameSiteStrictMode, "lax": http.SameSiteLaxMode, "none": http.SameSiteNoneMode}[cfg.SessionCookieSameSite],
+		Domain:   cfg.SessionCookieDomain,
+	}
+
+	// Social login: generic OIDC relying party per configured provider
+	var oidcProviders []*oidc.Provider
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders = append(oidcProviders, oidc.NewProvider(p.Name, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURI, p.Scopes))
+	}
+	identityRepo := repo.NewIdentityRepo(sqlDB)
+	oidcSvc := service.NewOIDCService(oidcProviders, identityRepo, userRepo, authSvc)
+	oidcHandler := oidcauth.NewHandler(oidcSvc, sessionCookies, cfg.OIDCFrontendURL)
+
+	// Middleware: to ensure protected route
+	authMiddleware := middleware.JWTAuth(cfg.JWTSecret, authSvc)
+	authHandler := auth.NewHandler(authSvc, userSvc, sessionCookies, authMiddleware)
+	// Idempotency-Key retries of state-changing requests, e.g. a double-clicked OP connect
+	idempotency := middleware.Idempotency(repo.NewIdempotencyRepo(sqlDB), time.Duration(cfg.IdempotencyWindow)*time.Second)
+
+	// Optional recording of sanitized OP requests and responses, for debugging and simulator fixtures
+	var opCalls oprecord.Store
+	switch cfg.OPRecorder {
+	case "off":
+	case "memory":
+		opCalls = oprecord.NewMemoryStore(cfg.OPRecorderSize)
+	case "postgres":
+		opCalls = oprecord.NewPostgresStore(sqlDB)
+	default:
+		return nil, fmt.Errorf("unknown OP_RECORDER %q", cfg.OPRecorder)
+	}
+
+	// OP Connect dependencies: per environment an mTLS client using its QWAC and an AIS client
+	// QWAC and QSEAL files are watched and reloaded without a restart
+	certManager := certs.NewManager()
+	var opEnvs []service.OPEnvironment
+	var jwks []wellknown.Key
+	var opCircuits []*opclient.Resilient
+	for _, e := range cfg.OPEnvironments {
+		qwac, err := certManager.AddQWAC(e.Name, e.QWACCertPath, e.QWACKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		qsealSigner, qsealAlg, qsealCert, err := newQSEALSigner(certManager, e)
+		if err != nil {
+			return nil, fmt.Errorf("OP environment %s: qseal: %v", e.Name, err)
+		}
+		keys, err := jwksKeys(certManager, e, qsealAlg, qsealCert)
+		if err != nil {
+			return nil, fmt.Errorf("OP environment %s: %v", e.Name, err)
+		}
+		jwks = append(jwks, keys...)
+		opHTTP, opTLS, err := opclient.NewMTLSClient(qwac.GetClientCertificate, e.CABundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("OP environment %s: %v", e.Name, err)
+		}
+		// Pooled connections keep the old certificate until closed
+		qwac.OnReload(opTLS.CloseIdleConnections)
+		// Retries, Retry-After and circuit breakers around every OP call; the recorder sits
+		// inside, so every attempt is recorded
+		opTransport := opHTTP.Transport
+		if opCalls != nil {
+			opTransport = &oprecord.Transport{Environment: e.Name, Base: opTransport, Store: opCalls}
+		}
+		opPolicy := opclient.NewResilient(e.Name, opTransport)
+		opCircuits = append(opCircuits, opPolicy)
+		// Detached JWS outermost: a retried request keeps its signature
+		jwksHTTP, err := opclient.NewTLSClient(e.CABundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("OP environment %s: %v", e.Name, err)
+		}
+		opKeys := opjwt.NewKeySet(e.JWKSURL, jwksHTTP)
+		opHTTP.Transport = &opclient.JWSTransport{Base: opPolicy, Policy: opclient.JWSPolicy{
+			Signer:      qsealSigner,
+			Alg:         qsealAlg,
+			Kid:         e.QSEALKid,
+			Endpoints:   jwsEndpoints(e.JWS.Endpoints),
+			Unencoded:   e.JWS.Unencoded,
+			Issuer:      e.JWS.Issuer,
+			TrustAnchor: e.JWS.TrustAnchor,
+			BankIssuer:  e.JWS.BankIssuer,
+			Keys:        opKeys.Key,
+		}}
+		opEnvs = append(opEnvs, service.OPEnvironment{
+			Name: e.Name,
+			Client: &opclient.AISClient{
+				HTTP:            opHTTP,
+				MTLSBase:        e.MTLSBase,
+				ClientID:        e.ClientID,
+				ClientSecret:    e.ClientSecret,
+				APIKey:          e.APIKey,
+				FAPIFinancialID: e.FAPIFinancialID,
+			},
+			AuthBase:    e.AuthBase,
+			RedirectURI: e.RedirectURI,
+			ClientID:    e.ClientID,
+			Aud:         e.RequestAud,
+			QSEAL:       qsealSigner,
+			QSEALAlg:    qsealAlg,
+			QSEALKid:    e.QSEALKid,
+		})
+	}
+
+	// Published QSEAL keys; a kid shared by environments must name one key
+	jwksHandler, err := wellknown.NewHandler(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	// OP Connect dependencies: Repo to store state -> authorizationId mapping
+	opRepo := repo.NewOPConnectRepo(sqlDB)
+
+	// OP Connect dependencies: Service creates auth intent + signs request JWT (QSEAL)
+	opSvc, err := service.NewOPConnectService(opEnvs, opRepo, auditRecorder)
+	if err != nil {
+		return nil, err
+	}
+
+	// OP Connect dependencies: HTTP handler
+	opHandler := opconnect.NewHandler(opSvc)
+
+	// GDPR: export archives and account deletion (revokes consents at OP)
+	privacySvc, err := service.NewPrivacyService(
+		userRepo,
+		sessionRepo,
+		signInRepo,
+		identityRepo,
+		opRepo,
+		repo.NewExportRepo(sqlDB),
+		auditRecorder,
+		opSvc,
+		opCalls,
+		notify.LogNotifier{},
+		authSvc,
+		cfg.ExportDir,
+		cfg.PublicBaseURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+	userHandler := user.NewHandler(authSvc, userSvc, privacySvc)
+
+	// Admin API: every action is written to the audit log
+	adminSvc := service.NewAdminService(userRepo, sessionRepo, opRepo, auditRecorder, opCalls)
+	adminHandler := admin.NewHandler(adminSvc)
+
+	// Probes: liveness is process only, readiness checks DB, schema and certificates (and shows OP circuits)
+	healthHandler := health.NewHandler(sqlDB, certManager, opCircuits)
+
+	// API description served to the frontend, built from the routes registered below
+	apiDoc := openapi.NewDocument(openapi.Info{Title: "One Point Ledger API", Version: "1.0.0", ServerURL: cfg.PublicBaseURL})
+
+	// Router: every route belongs to a group that applies its middleware stack
+	router := api.NewRouter()
+	public := router.Group("public")
+	authed := router.Group("authenticated", authMiddleware, idempotency)
+	staff := router.Group("staff", authMiddleware, middleware.RequireRole(model.RoleSupport, model.RoleAdmin), idempotency)
+	adminOnly := router.Group("admin", authMiddleware, middleware.RequireRole(model.RoleAdmin), idempotency)
+
+	// Routes: public
+	public.GET("/livez", "health.livez", healthHandler.Livez).Quiet = true
+	public.GET("/readyz", "health.readyz", healthHandler.Readyz).Quiet = true
+	public.GET("/openapi.json", "openapi.document", apiDoc.Serve).Conditional = true
+	public.GET("/.well-known/tpp-jwks.json", "wellknown.tppJWKS", jwksHandler.TPPJWKS).Conditional = true
+	public.POST("/auth/signup", "auth.signup", authHandler.Signup)
+	public.POST("/auth/login", "auth.login", authHandler.Login)
+	public.POST("/auth/refresh", "auth.refresh", authHandler.Refresh)
+	public.POST("/auth/logout", "auth.logout", authHandler.Logout)
+	public.GET("/auth/csrf", "auth.csrf", authHandler.CSRFToken)
+	public.POST("/auth/verify-email", "auth.verifyEmail", authHandler.VerifyEmail)
+	public.POST("/auth/password/forgot", "auth.forgotPassword", authHandler.ForgotPassword)
+	public.POST("/auth/password/reset", "auth.resetPassword", authHandler.ResetPassword)
+	public.GET("/auth/oidc/{provider}/start", "oidc.start", oidcHandler.Start).Timeout = 10 * time.Second
+	public.GET("/auth/oidc/{provider}/callback", "oidc.callback", oidcHandler.Callback).Timeout = 15 * time.Second
+	public.GET("/exports/{token}", "privacy.downloadExport", userHandler.DownloadExport)
+	public.GET("/connect/op/callback", "opconnect.callback", opCallbackHandler) // callback must be public because OP redirects without JWT
+
+	// Routes: authenticated
+	authed.GET("/me", "me.get", userHandler.Me).Conditional = true
+	authed.PATCH("/me", "me.update", userHandler.UpdateMe)
+	authed.DELETE("/me", "me.delete", userHandler.DeleteMe).Timeout = 30 * time.Second
+	authed.POST("/me/export", "me.requestExport", userHandler.RequestExport)
+	authed.GET("/me/export/{id}", "me.exportStatus", userHandler.ExportStatus).Conditional = true
+	authed.GET("/me/activity", "me.activity", userHandler.Activity).Conditional = true
+	authed.POST("/me/email", "me.changeEmail", userHandler.ChangeEmail)
+	authed.POST("/me/password", "me.changePassword", userHandler.ChangePassword)
+	authed.GET("/me/sessions", "me.sessions", userHandler.Sessions).Conditional = true
+	authed.DELETE("/me/sessions/{id}", "me.revokeSession", userHandler.RevokeSession)
+	authed.GET("/me/identities", "me.identities", oidcHandler.Identities).Conditional = true
+	authed.POST("/me/identities/{provider}", "me.linkIdentity", oidcHandler.Link).Timeout = 10 * time.Second
+	authed.DELETE("/me/identities/{provider}", "me.unlinkIdentity", oidcHandler.Unlink)
+	authed.POST("/connect/op/start", "opconnect.start", opHandler.Start).Timeout = 15 * time.Second
+
+	// Routes: staff and admin
+	staff.GET("/admin/users", "admin.searchUsers", adminHandler.SearchUsers)
+	staff.GET("/admin/users/{id}", "admin.getUser", adminHandler.GetUser).Conditional = true
+	adminOnly.POST("/admin/users/{id}/disable", "admin.disableUser", adminHandler.DisableUser)
+	adminOnly.POST("/admin/users/{id}/enable", "admin.enableUser", adminHandler.EnableUser)
+	adminOnly.PUT("/admin/users/{id}/role", "admin.setRole", adminHandler.SetRole)
+	adminOnly.POST("/admin/users/{id}/reconsent", "admin.forceReconsent", adminHandler.ForceReconsent)
+	adminOnly.GET("/admin/op-interactions", "admin.opInteractions", adminHandler.OPInteractions).Timeout = 10 * time.Second
+	adminOnly.GET("/admin/op-interactions/export", "admin.exportOPFixtures", adminHandler.ExportOPFixtures).Timeout = 30 * time.Second
+
+	// An undocumented route, or a documented one that is gone, stops the start
+	if err := apiDoc.Build(router.Routes()); err != nil {
+		return nil, err
+	}
+	var apiHandler http.Handler = router
+	if cfg.OpenAPIContract != "off" {
+		apiHandler = apiDoc.Contract(cfg.OpenAPIContract == "enforce")(router)
+	}
+
+	// Browser facing policy: security headers on everything, CORS (answers preflights before
+	// routing), then CSRF for cookie sessions
+	var hsts time.Duration
+	if strings.HasPrefix(cfg.PublicBaseURL, "https://") {
+		hsts = time.Duration(cfg.HSTSMaxAge) * time.Second
+	}
+	cors := middleware.CORS(middleware.CORSConfig{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           time.Duration(cfg.CORSMaxAge) * time.Second,
+	})
+	browserPolicy := func(h http.Handler) http.Handler {
+		return middleware.SecurityHeaders(hsts)(cors(middleware.CSRF(h)))
+	}
+
+	return &app{
+		handler: tracing.Middleware(browserPolicy(httpx.Compress(apiHandler))),
+		health:  healthHandler,
+		certs:   certManager,
+		privacy: privacySvc,
+	}, nil
+}
+
+func opCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	// Never rendered as HTML: the query is attacker controlled
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Callback received. Query params: " + query.Encode()))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/config"
+)
+
+// configCommand handles `server config check`: exit 0 when valid, 1 with every problem listed otherwise
+func configCommand(args []string) int {
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: server config check")
+		return 2
+	}
+
+	cfg, err := config.Load()
+	var invalid *config.Error
+	if err != nil && !errors.As(err, &invalid) {
+		// Config file unreadable: there is no effective config to show
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out, yamlErr := cfg.Redacted().YAML()
+	if yamlErr != nil {
+		fmt.Fprintln(os.Stderr, yamlErr)
+		return 1
+	}
+	fmt.Print(string(out))
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "configuration OK")
+	return 0
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/config"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/db"
+)
+
+// contractCase is one request; op names the route it is meant to reach
+type contractCase struct {
+	op     string
+	method string
+	path   string
+	body   string
+	auth   bool // send the bearer token
+	header map[string]string
+}
+
+// TestContract drives every documented route through the full handler with OPENAPI_CONTRACT
+// set to enforce, so an answer the document does not describe turns into a 500
+// contract_violation. Without TEST_DATABASE_URL the database is unreachable and mostly the
+// error answers are checked; with it (a migrated, disposable database) the success paths too.
+func TestContract(t *testing.T) {
+	env := contractEnv(t)
+	sqlDB := contractDB(t)
+
+	t.Run("bearer", func(t *testing.T) {
+		setEnv(t, env)
+		h := contractHandler(t, sqlDB)
+
+		token, userID, otherID := contractUsers(t, h, sqlDB)
+		ids := strings.NewReplacer("{self}", userID, "{other}", otherID, "{missing}", "00000000-0000-4000-8000-000000000000")
+		password := `{"password":"correct horse battery staple"}`
+
+		cases := []contractCase{
+			{op: "health.livez", method: "GET", path: "/livez"},
+			{op: "health.readyz", method: "GET", path: "/readyz"},
+			{op: "openapi.document", method: "GET", path: "/openapi.json"},
+			{op: "wellknown.tppJWKS", method: "GET", path: "/.well-known/tpp-jwks.json"},
+
+			{op: "auth.signup", method: "POST", path: "/auth/signup", body: `{"email":"contract-new@example.com","password":"correct horse battery staple"}`},
+			{op: "auth.signup", method: "POST", path: "/auth/signup", body: `{"email":"contract-new@example.com","password":"short"}`},
+			{op: "auth.signup", method: "POST", path: "/auth/signup", body: `{"email":"not an email","password":"correct horse battery staple"}`},
+			{op: "auth.signup", method: "POST", path: "/auth/signup", body: `{"email":"a@example.com","password":"x","admin":true}`},
+			{op: "auth.signup", method: "POST", path: "/auth/signup", body: `{`},
+			{op: "auth.signup", method: "POST", path: "/auth/signup", body: `{}`, header: map[string]string{"Content-Type": "text/plain"}},
+			{op: "auth.login", method: "POST", path: "/auth/login", body: `{"email":"nobody@example.com","password":"wrong password"}`},
+			{op: "auth.refresh", method: "POST", path: "/auth/refresh", body: `{"refreshToken":"unknown"}`},
+			{op: "auth.refresh", method: "POST", path: "/auth/refresh", body: `{}`},
+			{op: "auth.logout", method: "POST", path: "/auth/logout", body: `{"refreshToken":"unknown"}`},
+			{op: "auth.csrf", method: "GET", path: "/auth/csrf"},
+			{op: "auth.verifyEmail", method: "POST", path: "/auth/verify-email", body: `{"token":"unknown"}`},
+			{op: "auth.forgotPassword", method: "POST", path: "/auth/password/forgot", body: `{"email":"nobody@example.com"}`},
+			{op: "auth.resetPassword", method: "POST", path: "/auth/password/reset", body: `{"token":"unknown","newPassword":"correct horse battery staple"}`},
+			{op: "oidc.start", method: "GET", path: "/auth/oidc/unknown/start"},
+			{op: "oidc.callback", method: "GET", path: "/auth/oidc/unknown/callback?state=s&code=c"},
+			{op: "privacy.downloadExport", method: "GET", path: "/exports/unknown"},
+			{op: "opconnect.callback", method: "GET", path: "/connect/op/callback?code=c&state=s"},
+
+			{op: "me.get", method: "GET", path: "/me"},
+			{op: "me.get", method: "GET", path: "/me", auth: true},
+			{op: "me.get", method: "GET", path: "/me", header: map[string]string{"Authorization": "Basic abc"}},
+			{op: "me.update", method: "PATCH", path: "/me", auth: true, body: `{"displayName":"Contract","timezone":"Europe/Helsinki"}`},
+			{op: "me.update", method: "PATCH", path: "/me", auth: true, body: `{"timezone":"Nowhere/Else"}`},
+			{op: "me.requestExport", method: "POST", path: "/me/export", auth: true},
+			{op: "me.exportStatus", method: "GET", path: "/me/export/{missing}", auth: true},
+			{op: "me.activity", method: "GET", path: "/me/activity", auth: true},
+			{op: "me.changeEmail", method: "POST", path: "/me/email", auth: true, body: `{"email":"contract-other@example.com","password":"wrong password"}`},
+			{op: "me.changePassword", method: "POST", path: "/me/password", auth: true, body: `{"currentPassword":"wrong password","newPassword":"another correct horse battery"}`},
+			{op: "me.sessions", method: "GET", path: "/me/sessions", auth: true},
+			{op: "me.revokeSession", method: "DELETE", path: "/me/sessions/{missing}", auth: true},
+			{op: "me.identities", method: "GET", path: "/me/identities", auth: true},
+			{op: "me.linkIdentity", method: "POST", path: "/me/identities/unknown", auth: true},
+			{op: "me.unlinkIdentity", method: "DELETE", path: "/me/identities/unknown", auth: true},
+			{op: "opconnect.start", method: "POST", path: "/connect/op/start?env=unknown", auth: true},
+			{op: "opconnect.start", method: "POST", path: "/connect/op/start", auth: true, header: map[string]string{"Idempotency-Key": "contract-1"}},
+			{op: "opconnect.start", method: "POST", path: "/connect/op/start", auth: true, header: map[string]string{"Idempotency-Key": "bad key"}},
+
+			{op: "admin.searchUsers", method: "GET", path: "/admin/users?q=contract", auth: true},
+			{op: "admin.getUser", method: "GET", path: "/admin/users/{other}", auth: true},
+			{op: "admin.getUser", method: "GET", path: "/admin/users/not-a-uuid", auth: true},
+			{op: "admin.disableUser", method: "POST", path: "/admin/users/{other}/disable", auth: true},
+			{op: "admin.enableUser", method: "POST", path: "/admin/users/{other}/enable", auth: true},
+			{op: "admin.setRole", method: "PUT", path: "/admin/users/{other}/role", auth: true, body: `{"role":"support"}`},
+			{op: "admin.setRole", method: "PUT", path: "/admin/users/{self}/role", auth: true, body: `{"role":"user"}`},
+			{op: "admin.setRole", method: "PUT", path: "/admin/users/{other}/role", auth: true, body: `{"role":"root"}`},
+			{op: "admin.forceReconsent", method: "POST", path: "/admin/users/{other}/reconsent", auth: true},
+			{op: "admin.opInteractions", method: "GET", path: "/admin/op-interactions?limit=10", auth: true},
+			{op: "admin.opInteractions", method: "GET", path: "/admin/op-interactions?from=yesterday", auth: true},
+			{op: "admin.exportOPFixtures", method: "GET", path: "/admin/op-interactions/export", auth: true},
+
+			// Last: it ends the session the cases above use
+			{op: "me.delete", method: "DELETE", path: "/me", auth: true, body: `{"password":"wrong password"}`},
+			{op: "me.delete", method: "DELETE", path: "/me", auth: true, body: password},
+			{op: "auth.logout", method: "POST", path: "/auth/logout", auth: true},
+		}
+
+		reached := make(map[string]bool)
+		for _, c := range cases {
+			c.path = ids.Replace(c.path)
+			if c.auth {
+				c.header = withHeader(c.header, "Authorization", "Bearer "+token)
+			}
+			resp := serve(h, c, nil)
+			checkContract(t, c, resp)
+			reached[c.op] = true
+		}
+		for _, op := range documentedOperations(t, h) {
+			if !reached[op] {
+				t.Errorf("%s: documented but not driven by this test", op)
+			}
+		}
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		setEnv(t, env)
+		t.Setenv("SESSION_MODE", "cookie")
+		h := contractHandler(t, sqlDB)
+
+		// A refresh cookie without a CSRF token, then the token from /auth/csrf
+		session := []*http.Cookie{{Name: "opl_refresh", Value: "unknown"}}
+		refresh := contractCase{op: "auth.refresh", method: "POST", path: "/auth/refresh"}
+		resp := serve(h, refresh, session)
+		checkContract(t, refresh, resp)
+		if resp.Code != http.StatusForbidden {
+			t.Errorf("refresh without CSRF token: got %d, want 403", resp.Code)
+		}
+
+		issue := contractCase{op: "auth.csrf", method: "GET", path: "/auth/csrf"}
+		resp = serve(h, issue, session)
+		checkContract(t, issue, resp)
+		var issued struct {
+			CSRFToken string `json:"csrfToken"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &issued); err != nil || issued.CSRFToken == "" {
+			t.Fatalf("auth.csrf: no token in %s", resp.Body)
+		}
+		session = append(session, &http.Cookie{Name: "opl_csrf", Value: issued.CSRFToken})
+		csrf := map[string]string{"X-CSRF-Token": issued.CSRFToken}
+
+		for _, c := range []contractCase{
+			{op: "auth.refresh", method: "POST", path: "/auth/refresh", header: csrf},
+			{op: "auth.logout", method: "POST", path: "/auth/logout", header: csrf},
+		} {
+			checkContract(t, c, serve(h, c, session))
+		}
+	})
+}
+
+func serve(h http.Handler, c contractCase, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+	if c.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range c.header {
+		req.Header.Set(k, v)
+	}
+	for _, ck := range cookies {
+		req.AddCookie(ck)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func checkContract(t *testing.T, c contractCase, resp *httptest.ResponseRecorder) {
+	t.Helper()
+	var problem struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if resp.Code == http.StatusInternalServerError && json.Unmarshal(resp.Body.Bytes(), &problem) == nil && problem.Error == "contract_violation" {
+		t.Errorf("%s %s %s: %s", c.op, c.method, c.path, problem.Message)
+		return
+	}
+	t.Logf("%s %s %s: %d", c.op, c.method, c.path, resp.Code)
+}
+
+// documentedOperations lists the operationIds of the served document
+func documentedOperations(t *testing.T, h http.Handler) []string {
+	resp := serve(h, contractCase{method: "GET", path: "/openapi.json"}, nil)
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	var ops []string
+	for _, methods := range doc.Paths {
+		for _, op := range methods {
+			ops = append(ops, op.OperationID)
+		}
+	}
+	return ops
+}
+
+func contractHandler(t *testing.T, sqlDB *sql.DB) http.Handler {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newApp(cfg, sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Exports write into EXPORT_DIR in the background; finish before it is removed
+	t.Cleanup(func() { a.privacy.Wait(context.Background()) })
+	return a.handler
+}
+
+// contractDB opens TEST_DATABASE_URL, or a pool whose every query fails at once
+func contractDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		sqlDB, err := db.Open(t.Context(), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqlDB.Close() })
+		return sqlDB
+	}
+	sqlDB, err := sql.Open("pgx", "postgres://contract@127.0.0.1:1/contract?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return sqlDB
+}
+
+// contractUsers returns a bearer token of an admin and the ids of that admin and of another
+// user. Without a database the token is signed here and its session cannot be checked.
+func contractUsers(t *testing.T, h http.Handler, sqlDB *sql.DB) (token, userID, otherID string) {
+	t.Helper()
+	if os.Getenv("TEST_DATABASE_URL") == "" {
+		userID, otherID = "11111111-1111-4111-8111-111111111111", "22222222-2222-4222-8222-222222222222"
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":  userID,
+			"sid":  "33333333-3333-4333-8333-333333333333",
+			"role": "admin",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(os.Getenv("JWT_SECRET")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed, userID, otherID
+	}
+
+	suffix := time.Now().Format("20060102150405.000000")
+	signup := func(email string) string {
+		c := contractCase{op: "auth.signup", method: "POST", path: "/auth/signup",
+			body: `{"email":"` + email + `","password":"correct horse battery staple"}`}
+		resp := serve(h, c, nil)
+		checkContract(t, c, resp)
+		var u struct {
+			ID string `json:"id"`
+		}
+		if resp.Code != http.StatusCreated || json.Unmarshal(resp.Body.Bytes(), &u) != nil {
+			t.Fatalf("signup %s: %d %s", email, resp.Code, resp.Body)
+		}
+		return u.ID
+	}
+	admin := "contract-admin-" + suffix + "@example.com"
+	userID = signup(admin)
+	otherID = signup("contract-user-" + suffix + "@example.com")
+	if _, err := sqlDB.ExecContext(t.Context(), `UPDATE users SET role = 'admin' WHERE id = $1`, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	c := contractCase{op: "auth.login", method: "POST", path: "/auth/login",
+		body: `{"email":"` + admin + `","password":"correct horse battery staple"}`}
+	resp := serve(h, c, nil)
+	checkContract(t, c, resp)
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &tokens) != nil {
+		t.Fatalf("login: %d %s", resp.Code, resp.Body)
+	}
+	return tokens.Token, userID, otherID
+}
+
+// contractEnv is the configuration of the app under test: one OP environment whose endpoints
+// refuse connections, with a throwaway key and certificate as QWAC and QSEAL
+func contractEnv(t *testing.T) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	certPath, keyPath := writeSelfSigned(t, dir)
+	closed := "http://127.0.0.1:1"
+	return map[string]string{
+		"CONFIG_FILE":          "",
+		"DATABASE_URL":         "postgres://unused",
+		"JWT_SECRET":           "contract-test-secret-contract-test-secret",
+		"OPENAPI_CONTRACT":     "enforce",
+		"EXPORT_DIR":           filepath.Join(dir, "exports"),
+		"SESSION_MODE":         "bearer",
+		"OIDC_PROVIDERS":       "",
+		"OP_RECORDER":          "memory",
+		"OP_PROFILE":           "sandbox",
+		"OP_MTLS_BASE":         closed,
+		"OP_AUTH_BASE":         closed,
+		"OP_ISSUER":            closed,
+		"OP_JWKS_URL":          closed + "/jwks",
+		"OP_CLIENT_ID":         "contract",
+		"OP_CLIENT_SECRET":     "contract",
+		"OP_API_KEY":           "contract",
+		"OP_FAPI_FINANCIAL_ID": "contract",
+		"OP_REDIRECT_URI":      "http://localhost:8080/connect/op/callback",
+		"OP_QWAC_CERT_PATH":    certPath,
+		"OP_QWAC_KEY_PATH":     keyPath,
+		"OP_QSEAL_SIGNER":      "file",
+		"OP_QSEAL_KEY_PATH":    keyPath,
+		"OP_QSEAL_CERT_PATH":   certPath,
+		"OP_QSEAL_KID":         "contract",
+	}
+}
+
+func setEnv(t *testing.T, env map[string]string) {
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+}
+
+func withHeader(h map[string]string, k, v string) map[string]string {
+	out := map[string]string{k: v}
+	for hk, hv := range h {
+		out[hk] = hv
+	}
+	return out
+}
+
+func writeSelfSigned(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "contract"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
@@ -5,67 +5,60 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // profile timezones must validate in minimal containers
 
-	"github.com/shahnajsc/OnePointLedger/backend/internal/api/auth"
-	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
-	"github.com/shahnajsc/OnePointLedger/backend/internal/api/opconnect"
-	"github.com/shahnajsc/OnePointLedger/backend/internal/api/user"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/config"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/db"
-	"github.com/shahnajsc/OnePointLedger/backend/internal/opclient"
-	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
-	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/metrics"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/tracing"
 	"github.com/joho/godotenv"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
-
-func opCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Callback received. Query params: " + query.Encode()))
-}
-
-func mustEnv(name, value string) {
-	if value == "" {
-		log.Fatalf("%s is missing", name)
-	}
-}
-
 func main() {
 	// Load config
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("No .env file found, relying on environment variables")
 	}
-	cfg := config.Load()
-
-	// Required basic env
-	mustEnv("DATABASE_URL", cfg.DatabaseURL)
-	mustEnv("JWT_SECRET", cfg.JWTSecret)
-
-	// Required OP env (for /connect/op/start)
-	mustEnv("OP_MTLS_BASE", cfg.OPMTLSBase)
-	mustEnv("OP_AUTH_BASE", cfg.OPAuthBase)
-	mustEnv("OP_CLIENT_ID", cfg.OPClientID)
-	mustEnv("OP_CLIENT_SECRET", cfg.OPClientSecret)
-	mustEnv("OP_API_KEY", cfg.OPAPIKey)
-	mustEnv("OP_FAPI_FINANCIAL_ID", cfg.OPFAPIFinancialID)
-	mustEnv("OP_REDIRECT_URI", cfg.OPRedirectURI)
-	mustEnv("OP_QWAC_CERT_PATH", cfg.OPQWACCertPath)
-	mustEnv("OP_QWAC_KEY_PATH", cfg.OPQWACKeyPath)
-	mustEnv("OP_QSEAL_KEY_PATH", cfg.OPQSEALKeyPath)
-	mustEnv("OP_QSEAL_KID", cfg.OPQSEALKid)
-
-	log.Println("OP client_id:", cfg.OPClientID) // for Debug
-
-	// Audience for OP request JWT (optional?)
-	opAud := os.Getenv("OP_REQUEST_AUD")
-	if opAud == "" {
-		opAud = cfg.OPMTLSBase // reasonable default for sandbox
+
+	// `server config check` validates and prints the effective config without starting
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.OPDebugLogClientID {
+		for _, e := range cfg.OPEnvironments {
+			log.Printf("OP %s client_id: %s", e.Name, e.ClientID)
+		}
+	}
+
+	// Tracing must be on before db.Open so the pool's connections are traced
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.TracesExporter != "none" {
+		var exporter sdktrace.SpanExporter
+		switch cfg.TracesExporter {
+		case "stdout":
+			exporter, err = tracing.NewStdoutExporter()
+		case "otlp":
+			exporter, err = tracing.NewOTLPExporter(context.Background(), cfg.OTLPEndpoint)
+		default:
+			log.Fatalf("unknown OTEL_TRACES_EXPORTER %q (none|stdout|otlp)", cfg.TracesExporter)
+		}
+		if err != nil {
+			log.Fatal("trace exporter: ", err)
+		}
+		if shutdownTracing, err = tracing.Init(exporter, cfg.TraceServiceName); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	// DB connection (database/sql pool)
@@ -76,72 +69,72 @@ func main() {
 	}
 	defer sqlDB.Close()
 
-	// Auth / User
-	userRepo := repo.NewUserRepo(sqlDB)
-	authSvc := service.NewAuthService(userRepo, cfg.JWTSecret)
-	authHandler := auth.NewHandler(authSvc)
-	userHandler := user.NewHandler()
-
-	// Middleware: to ensure protected route
-	authMiddleware := middleware.JWTAuth(cfg.JWTSecret)
-
-	// OP Connect dependencies: mTLS HTTP client using QWAC
-	opHTTP, err := opclient.NewMTLSClient(cfg.OPQWACCertPath, cfg.OPQWACKeyPath)
+	a, err := newApp(cfg, sqlDB)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// OP Connect dependencies: AIS client (client credentials + /authorizations)
-	ais := &opclient.AISClient{
-		HTTP:            opHTTP,
-		MTLSBase:        cfg.OPMTLSBase,
-		ClientID:        cfg.OPClientID,
-		ClientSecret:    cfg.OPClientSecret,
-		APIKey:          cfg.OPAPIKey,
-		FAPIFinancialID: cfg.OPFAPIFinancialID,
+	// Backend
+	server := &http.Server{
+		Addr:              ":8080",
+		Handler:           a.handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      60 * time.Second, // export downloads
+		IdleTimeout:       120 * time.Second,
 	}
-
-	// OP Connect dependencies: Repo to store state -> authorizationId mapping
-	opRepo := repo.NewOPConnectRepo(sqlDB)
-
-	// OP Connect dependencies: Service creates auth intent + signs request JWT (QSEAL)
-	opSvc, err := service.NewOPConnectService(
-		ais,
-		opRepo,
-		cfg.OPAuthBase,
-		cfg.OPRedirectURI,
-		cfg.OPClientID,
-		opAud,
-		cfg.OPQSEALKeyPath,
-		cfg.OPQSEALKid,
-	)
-	if err != nil {
-		log.Fatal(err)
+	// Metrics on their own listener, which only the cluster reaches; the public port has no /metrics
+	metricsMux := http.NewServeMux()
+	metricsMux.HandleFunc("GET /metrics", metrics.Handler)
+	metricsServer := &http.Server{
+		Addr:              cfg.MetricsAddr,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	// OP Connect dependencies: HTTP handler
-	opHandler := opconnect.NewHandler(opSvc)
+	// Stop on SIGINT/SIGTERM: fail readiness, finish in-flight requests (OP callbacks), drain workers
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go a.certs.Run(sigCtx, 30*time.Second)
 
-	// Router
-	mux := http.NewServeMux()
+	serveErr := make(chan error, 2)
+	go func() {
+		log.Println("Starting server on :8080")
+		serveErr <- server.ListenAndServe()
+	}()
+	go func() {
+		log.Println("Serving metrics on", cfg.MetricsAddr)
+		serveErr <- metricsServer.ListenAndServe()
+	}()
 
-	// Routes
-	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/auth/signup", authHandler.Signup)
-	mux.HandleFunc("/auth/login", authHandler.Login)
-	mux.HandleFunc("/connect/op/callback", opCallbackHandler) // callback must be public because OP redirects without JWT
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-sigCtx.Done():
+	}
 
-	// Routes: protected
-	mux.Handle("/me", authMiddleware(http.HandlerFunc(userHandler.Me)))
-	mux.Handle("/connect/op/start", authMiddleware(http.HandlerFunc(opHandler.Start)))
+	log.Println("Shutting down")
+	a.health.SetDraining()
+	// Keep serving until load balancers have seen /readyz fail, or they route requests to a
+	// closed listener
+	time.Sleep(time.Duration(cfg.ShutdownDelay) * time.Second)
 
-	// Backend
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("http shutdown:", err)
 	}
-	log.Println("Starting server on :8080")
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		log.Println("metrics shutdown:", err)
+	}
+	if err := a.privacy.Wait(shutdownCtx); err != nil {
+		log.Println("background exports still running:", err)
+	}
+	// Last, so spans of the drained requests and exports are flushed too
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Println(err)
 	}
+	log.Println("Stopped")
 }
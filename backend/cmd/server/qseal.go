@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/wellknown"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/certs"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/config"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/qseal"
+)
+
+// newQSEALSigner builds the signing backend of an OP environment and the JWS alg it signs with.
+// The QSEAL certificate is managed (expiry, reload) whatever holds the key.
+func newQSEALSigner(m *certs.Manager, e config.OPEnvironment) (crypto.Signer, string, *certs.Cert, error) {
+	keyPath := ""
+	if e.QSEALSigner == "file" {
+		keyPath = e.QSEALKeyPath
+	}
+	cert, err := m.AddQSEAL(e.Name, e.QSEALCertPath, keyPath)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var signer crypto.Signer
+	switch e.QSEALSigner {
+	case "file":
+		signer = cert
+	case "pkcs11":
+		signer, err = qseal.NewPKCS11Signer(qseal.PKCS11Config{
+			Module:     e.QSEALPKCS11.Module,
+			TokenLabel: e.QSEALPKCS11.TokenLabel,
+			PIN:        e.QSEALPKCS11.PIN,
+			KeyLabel:   e.QSEALPKCS11.KeyLabel,
+		}, cert.Certificate().PublicKey)
+	case "remote":
+		signer = qseal.NewRemoteSigner(e.QSEALRemote.URL, e.QSEALRemote.Token, e.QSEALRemote.KeyID, cert.Certificate().PublicKey)
+	default:
+		err = errors.New("unknown signer " + e.QSEALSigner)
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	alg, err := opjwt.Algorithm(signer.Public(), e.QSEALAlg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return signer, alg, cert, nil
+}
+
+// jwksKeys lists what /.well-known/tpp-jwks.json publishes for an environment: the active
+// QSEAL key and the extra rotation certificates, which are managed for expiry too
+func jwksKeys(m *certs.Manager, e config.OPEnvironment, alg string, cert *certs.Cert) ([]wellknown.Key, error) {
+	keys := []wellknown.Key{{Kid: e.QSEALKid, Alg: alg, Cert: cert}}
+	for _, k := range e.JWKSExtraKeys() {
+		kid := k.Kid
+		extra, err := m.AddQSEAL(e.Name+"/"+kid, k.CertPath, "")
+		if err != nil {
+			return nil, err
+		}
+		pub := extra.Certificate().PublicKey
+		// Same alg as the active key when it fits, so rotation does not change verifier settings
+		extraAlg, err := opjwt.Algorithm(pub, e.QSEALAlg)
+		if err != nil {
+			if extraAlg, err = opjwt.Algorithm(pub, ""); err != nil {
+				return nil, fmt.Errorf("jwks key %s: %w", kid, err)
+			}
+		}
+		keys = append(keys, wellknown.Key{Kid: kid, Alg: extraAlg, Cert: extra})
+	}
+	return keys, nil
+}
+
+// jwsEndpoints turns the configured endpoint names into the set JWSTransport looks up
+func jwsEndpoints(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
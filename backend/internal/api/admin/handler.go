@@ -0,0 +1,143 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/request"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+)
+
+type Handler struct {
+	svc *service.AdminService
+}
+
+func NewHandler(svc *service.AdminService) *Handler {
+	request.Register(roleReq{})
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	ctx := r.Context()
+
+	users, err := h.svc.SearchUsers(ctx, actor(r), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		httpx.WriteError(w, "internal_error", "could not search users", http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []model.User{}
+	}
+	httpx.WriteJSON(w, map[string]any{"users": users}, http.StatusOK)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	ov, err := h.svc.UserOverview(ctx, actor(r), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if ov.Connections == nil {
+		ov.Connections = []model.Connection{}
+	}
+	httpx.WriteJSON(w, ov, http.StatusOK)
+}
+
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := h.svc.SetDisabled(ctx, actor(r), userID, disabled); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type roleReq struct {
+	Role string `json:"role" validate:"required,oneof=user support admin"`
+}
+
+func (h *Handler) SetRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req roleReq
+	if !request.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := h.svc.SetRole(ctx, actor(r), userID, req.Role); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ForceReconsent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	n, err := h.svc.ForceReconsent(ctx, actor(r), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	httpx.WriteJSON(w, map[string]int64{"connections": n}, http.StatusOK)
+}
+
+func actor(r *http.Request) service.Actor {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+	return service.Actor{UserID: userID}
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case service.IsNoRows(err):
+		httpx.WriteError(w, "user_not_found", "user not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidRole):
+		httpx.WriteError(w, "invalid_role", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrOwnRole):
+		httpx.WriteError(w, "own_role", err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrLastAdmin):
+		httpx.WriteError(w, "last_admin", err.Error(), http.StatusConflict)
+	default:
+		httpx.WriteError(w, "internal_error", "admin action failed", http.StatusInternalServerError)
+	}
+}
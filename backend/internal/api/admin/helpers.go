@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+)
+
+// pathUserID rejects ids that are not UUIDs before they reach Postgres
+func pathUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if !isUUID(id) {
+		httpx.WriteError(w, "user_not_found", "user not found", http.StatusNotFound)
+		return "", false
+	}
+	return id, true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
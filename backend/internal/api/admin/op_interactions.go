@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oprecord"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+)
+
+// OPInteractions lists recorded OP calls: ?user=<id>&from=<RFC3339>&to=<RFC3339>&limit=
+func (h *Handler) OPInteractions(w http.ResponseWriter, r *http.Request) {
+	f, err := interactionFilter(r, 100)
+	if err != nil {
+		httpx.WriteError(w, "invalid_query", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	items, err := h.svc.OPInteractions(ctx, actor(r), f)
+	if err != nil {
+		writeRecorderError(w, err)
+		return
+	}
+	streamList(w, "interactions", nil, items)
+}
+
+// ExportOPFixtures downloads the same selection as simulator fixtures, oldest first
+func (h *Handler) ExportOPFixtures(w http.ResponseWriter, r *http.Request) {
+	f, err := interactionFilter(r, 1000)
+	if err != nil {
+		httpx.WriteError(w, "invalid_query", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	fixtures, err := h.svc.ExportOPFixtures(ctx, actor(r), f)
+	if err != nil {
+		writeRecorderError(w, err)
+		return
+	}
+	name := "op-fixtures-" + time.Now().UTC().Format("20060102T150405Z") + ".json"
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	streamList(w, "interactions", map[string]any{"version": fixtures.Version}, fixtures.Interactions)
+}
+
+// streamList answers 200 with items as the array member field, one element at a time; the
+// interaction lists run into the thousands with full request and response bodies
+func streamList[T any](w http.ResponseWriter, field string, fields map[string]any, items []T) {
+	a, err := httpx.StreamArray(w, http.StatusOK, field, fields)
+	for _, item := range items {
+		if err != nil {
+			break
+		}
+		err = a.Write(item)
+	}
+	if err == nil {
+		err = a.Close()
+	}
+	if err != nil {
+		log.Println("stream", field+":", err)
+	}
+}
+
+func interactionFilter(r *http.Request, maxLimit int) (oprecord.Filter, error) {
+	q := r.URL.Query()
+	f := oprecord.Filter{UserID: q.Get("user"), Limit: maxLimit}
+	if f.UserID != "" && !isUUID(f.UserID) {
+		return f, errors.New("user must be a user id")
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxLimit {
+			return f, fmt.Errorf("limit must be 1..%d", maxLimit)
+		}
+		f.Limit = n
+	}
+	for name, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*t = parsed
+		}
+	}
+	return f, nil
+}
+
+func writeRecorderError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrRecorderDisabled) {
+		httpx.WriteError(w, "recorder_disabled", err.Error(), http.StatusNotFound)
+		return
+	}
+	httpx.WriteError(w, "internal_error", "could not read OP interactions", http.StatusInternalServerError)
+}
@@ -1,93 +1,297 @@
 package auth
 
 import (
-	"encoding/json"
 	"net/http"
-	"strings"
-	"time"
-	"context"
 	"errors"
+	"log"
 
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/request"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/password"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Handler struct {
-	auth *service.AuthService
+	auth    *service.AuthService
+	users   *service.UserService
+	cookies middleware.SessionCookies
+	// bearerLogout revokes the session of the access token, behind requireAuth
+	bearerLogout http.Handler
 }
 
-func NewHandler(auth *service.AuthService) *Handler {
-	return &Handler{auth: auth}
+// requireAuth is the JWT middleware, applied by Logout when no refresh token is sent
+func NewHandler(auth *service.AuthService, users *service.UserService, cookies middleware.SessionCookies, requireAuth func(http.Handler) http.Handler) *Handler {
+	request.Register(creds{}, verifyEmailReq{}, refreshReq{}, forgotReq{}, resetReq{})
+	h := &Handler{auth: auth, users: users, cookies: cookies}
+	h.bearerLogout = requireAuth(http.HandlerFunc(h.logoutSession))
+	return h
 }
 
+// Password strength is checked by the service password policy
 type creds struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-func (c creds) valid() bool {
-	return strings.Contains(c.Email, "@") && len(c.Password) >= 8
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"`
 }
 
 func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := contextWithTimeout(r, 5*time.Second)
-	defer cancel()
+	ctx := r.Context()
 
 	var c creds
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
-		return
-	}
-	if !c.valid() {
-		http.Error(w, "invalid email or password (min 8 chars)", http.StatusBadRequest)
+	if !request.Decode(w, r, &c) {
 		return
 	}
 
-	u, err := h.auth.Signup(ctx, c.Email, c.Password)
+	u, err := h.auth.Signup(ctx, c.Email, c.Password, middleware.ClientIP(r))
 	if err != nil {
+		if httpx.WriteLimited(w, err) || writePolicyError(w, err) {
+			return
+		}
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			http.Error(w, "email already registered", http.StatusConflict)
+			httpx.WriteError(w, "email_taken", "email already registered", http.StatusConflict)
 			return
 		}
-		http.Error(w, "could not create user", http.StatusBadRequest)
+		httpx.WriteError(w, "internal_error", "could not create user", http.StatusInternalServerError)
 		return
 	}
 
+	// Account works without verification; a failed mail must not fail the signup
+	if err := h.users.SendVerification(ctx, u.ID, u.Email); err != nil {
+		log.Println("signup verification:", err)
+	}
+
 	resp := map[string]any{
-		"id":        u.ID,
-		"email":     u.Email,
-		"createdAt": u.CreatedAt,
+		"id":            u.ID,
+		"email":         u.Email,
+		"emailVerified": u.EmailVerified,
+		"createdAt":     u.CreatedAt,
 	}
-	writeJSON(w, resp, http.StatusCreated)
+	httpx.WriteJSON(w, resp, http.StatusCreated)
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req verifyEmailReq
+	if !request.Decode(w, r, &req) {
+		return
+	}
+
+	if err := h.users.VerifyEmail(ctx, req.Token); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, service.ErrInvalidVerificationToken):
+			httpx.WriteError(w, "invalid_token", err.Error(), http.StatusBadRequest)
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			httpx.WriteError(w, "email_taken", "email already registered", http.StatusConflict)
+		default:
+			httpx.WriteError(w, "internal_error", "could not verify email", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := contextWithTimeout(r, 5*time.Second)
-	defer cancel()
+	ctx := r.Context()
 
 	var c creds
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if !request.Decode(w, r, &c) {
+		return
+	}
+
+	tokens, err := h.auth.Login(ctx, c.Email, c.Password, clientInfo(r))
+	if err != nil {
+		if httpx.WriteLimited(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			httpx.WriteError(w, "account_disabled", "account disabled", http.StatusForbidden)
+			return
+		}
+		httpx.WriteError(w, "invalid_credentials", "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	h.writeTokens(w, tokens)
+}
+
+type refreshReq struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Cookie mode sends the refresh token as a cookie and no body
+	var req refreshReq
+	if req.RefreshToken = h.cookies.RefreshToken(r); req.RefreshToken == "" {
+		if !request.Decode(w, r, &req) {
+			return
+		}
+	}
+
+	tokens, err := h.auth.Refresh(ctx, req.RefreshToken, clientInfo(r))
+	if err != nil {
+		if h.cookies.Enabled {
+			h.cookies.Clear(w)
+		}
+		httpx.WriteError(w, "invalid_refresh_token", "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	h.writeTokens(w, tokens)
+}
+
+// Logout revokes a session (public route). The refresh token outlives the access token, so
+// it is used when sent: as the cookie in cookie mode, or in the body. Without one the access
+// token's session is revoked. An unknown refresh token is already unusable and still logs out.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req refreshReq
+	if req.RefreshToken = h.cookies.RefreshToken(r); req.RefreshToken == "" && r.ContentLength != 0 {
+		if !request.Decode(w, r, &req) {
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		h.bearerLogout.ServeHTTP(w, r)
 		return
 	}
 
-	token, err := h.auth.Login(ctx, c.Email, c.Password)
+	if err := h.auth.Logout(ctx, req.RefreshToken); err != nil && !errors.Is(err, service.ErrInvalidRefreshToken) {
+		httpx.WriteError(w, "internal_error", "could not log out", http.StatusInternalServerError)
+		return
+	}
+	if h.cookies.Enabled {
+		h.cookies.Clear(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutSession revokes the session of the calling access token
+func (h *Handler) logoutSession(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+	sessionID, _ := middleware.SessionIDFromContext(r.Context())
+
+	ctx := r.Context()
+
+	if err := h.auth.RevokeSession(ctx, userID, sessionID); err != nil && !service.IsNoRows(err) {
+		httpx.WriteError(w, "internal_error", "could not log out", http.StatusInternalServerError)
+		return
+	}
+	if h.cookies.Enabled {
+		h.cookies.Clear(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CSRFToken issues a new double-submit token in cookie mode, for a frontend that lost the
+// opl_csrf cookie but still holds a session or refresh cookie. A GET is not checked by the
+// CSRF middleware, and another origin cannot read the answer.
+func (h *Handler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	if !h.cookies.Enabled {
+		httpx.WriteError(w, "cookie_sessions_disabled", "cookie sessions are disabled", http.StatusNotFound)
+		return
+	}
+	csrf, err := middleware.SetCSRFCookie(w, h.cookies.Secure, h.cookies.SameSite, h.auth.RefreshExpiresIn())
 	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		httpx.WriteError(w, "internal_error", "could not issue CSRF token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httpx.WriteJSON(w, map[string]any{"csrfToken": csrf}, http.StatusOK)
+}
+
+type forgotReq struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+// ForgotPassword always answers 202 so it cannot be used to probe for accounts
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req forgotReq
+	if !request.Decode(w, r, &req) {
+		return
+	}
+
+	if err := h.auth.RequestPasswordReset(ctx, req.Email, middleware.ClientIP(r)); err != nil {
+		if httpx.WriteLimited(w, err) {
+			return
+		}
+		httpx.WriteError(w, "internal_error", "could not request password reset", http.StatusInternalServerError)
 		return
 	}
+	w.WriteHeader(http.StatusAccepted)
+}
 
-	writeJSON(w, map[string]string{"token": token}, http.StatusOK)
+type resetReq struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required"`
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req resetReq
+	if !request.Decode(w, r, &req) {
+		return
+	}
+
+	if err := h.auth.ResetPassword(ctx, req.Token, req.NewPassword); err != nil {
+		if writePolicyError(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			httpx.WriteError(w, "invalid_token", err.Error(), http.StatusBadRequest)
+			return
+		}
+		httpx.WriteError(w, "internal_error", "could not reset password", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // Helper func
-func writeJSON(w http.ResponseWriter, v any, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(v)
+func clientInfo(r *http.Request) service.ClientInfo {
+	return service.ClientInfo{IP: middleware.ClientIP(r), UserAgent: r.UserAgent()}
+}
+
+// writeTokens answers a login or refresh. In cookie mode the tokens only go into HttpOnly
+// cookies and the body carries the CSRF token; "token" is kept as the access token key for
+// existing bearer clients.
+func (h *Handler) writeTokens(w http.ResponseWriter, t service.Tokens) {
+	if !h.cookies.Enabled {
+		httpx.WriteJSON(w, map[string]any{
+			"token":        t.AccessToken,
+			"refreshToken": t.RefreshToken,
+			"expiresIn":    t.ExpiresIn,
+		}, http.StatusOK)
+		return
+	}
+	csrf, err := h.cookies.Write(w, t.AccessToken, t.ExpiresIn, t.RefreshToken, t.RefreshExpiresIn)
+	if err != nil {
+		httpx.WriteError(w, "internal_error", "could not start session", http.StatusInternalServerError)
+		return
+	}
+	httpx.WriteJSON(w, map[string]any{"expiresIn": t.ExpiresIn, "csrfToken": csrf}, http.StatusOK)
 }
 
-func contextWithTimeout(r *http.Request, d time.Duration) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(r.Context(), d)
+func writePolicyError(w http.ResponseWriter, err error) bool {
+	var pe *password.PolicyError
+	if !errors.As(err, &pe) {
+		return false
+	}
+	httpx.WriteJSON(w, map[string]any{"error": "weak_password", "reasons": pe.Reasons}, http.StatusBadRequest)
+	return true
 }
+
+
+
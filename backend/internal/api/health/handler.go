@@ -0,0 +1,147 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/certs"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/db"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opclient"
+)
+
+// Handler serves the liveness and readiness probes
+type Handler struct {
+	db         *sql.DB
+	certs      *certs.Manager
+	opCircuits []*opclient.Resilient
+	draining   atomic.Bool
+}
+
+func NewHandler(sqlDB *sql.DB, certManager *certs.Manager, opCircuits []*opclient.Resilient) *Handler {
+	return &Handler{db: sqlDB, certs: certManager, opCircuits: opCircuits}
+}
+
+// SetDraining makes /readyz fail so load balancers stop sending traffic during shutdown
+func (h *Handler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Livez only says the process is up; it must not depend on anything external
+func (h *Handler) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+type check struct {
+	Name        string      `json:"name"`
+	OK          bool        `json:"ok"`
+	Detail      string      `json:"detail,omitempty"`
+	Certificate *certs.Info `json:"certificate,omitempty"`
+}
+
+// Readyz checks DB connectivity, schema version and the QWAC/QSEAL certificates
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	checks := []check{
+		h.checkDraining(),
+		h.checkDB(ctx),
+		h.checkSchema(ctx),
+	}
+	for _, c := range h.certs.Certs() {
+		checks = append(checks, checkCert(c))
+	}
+	for _, r := range h.opCircuits {
+		checks = append(checks, checkCircuits(r))
+	}
+
+	status := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httpx.WriteJSON(w, map[string]any{"ready": status == http.StatusOK, "checks": checks}, status)
+}
+
+func (h *Handler) checkDraining() check {
+	if h.draining.Load() {
+		return check{Name: "shutdown", OK: false, Detail: "draining"}
+	}
+	return check{Name: "shutdown", OK: true}
+}
+
+// Errors are logged, not answered: /readyz is public and they name hosts and paths
+
+func (h *Handler) checkDB(ctx context.Context) check {
+	if err := h.db.PingContext(ctx); err != nil {
+		log.Println("readyz: database:", err)
+		return check{Name: "database", OK: false, Detail: "unreachable"}
+	}
+	return check{Name: "database", OK: true}
+}
+
+func (h *Handler) checkSchema(ctx context.Context) check {
+	v, err := db.CurrentSchemaVersion(ctx, h.db)
+	if err != nil {
+		log.Println("readyz: schema:", err)
+		return check{Name: "schema", OK: false, Detail: "version unknown"}
+	}
+	if v < db.SchemaVersion {
+		return check{Name: "schema", OK: false, Detail: fmt.Sprintf("version %d, need %d", v, db.SchemaVersion)}
+	}
+	return check{Name: "schema", OK: true, Detail: fmt.Sprintf("version %d", v)}
+}
+
+// checkCert fails only when the certificate in use is not valid now. A failed reload keeps
+// the previous certificate in use, so it is reported without failing readiness.
+func checkCert(c *certs.Cert) check {
+	name := c.Kind + ":" + c.Name
+	info, err := c.Info()
+	if info == nil {
+		ch := check{Name: name, OK: true, Detail: "no certificate configured, key only"}
+		if err != nil {
+			ch.Detail = "reload failed, see logs" // the manager logs the error
+		}
+		return ch
+	}
+
+	ch := check{Name: name, OK: true, Certificate: info, Detail: "expires " + info.NotAfter.UTC().Format(time.RFC3339)}
+	now := time.Now()
+	if now.After(info.NotAfter) || now.Before(info.NotBefore) {
+		ch.OK = false
+		ch.Detail = "not valid now, expires " + info.NotAfter.UTC().Format(time.RFC3339)
+	}
+	if err != nil {
+		ch.Detail += "; reload failed, see logs"
+	}
+	return ch
+}
+
+// checkCircuits shows open OP circuits but never fails readiness: OP being down is not fixed by
+// taking our instances out of the load balancer, and the rest of the API still works
+func checkCircuits(r *opclient.Resilient) check {
+	var open []string
+	for ep, state := range r.Circuits() {
+		if state != "closed" {
+			open = append(open, ep+" "+state)
+		}
+	}
+	if len(open) == 0 {
+		return check{Name: "op:" + r.Environment, OK: true, Detail: "circuits closed"}
+	}
+	sort.Strings(open)
+	return check{Name: "op:" + r.Environment, OK: true, Detail: strings.Join(open, ", ")}
+}
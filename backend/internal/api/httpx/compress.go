@@ -0,0 +1,178 @@
+package httpx
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Smaller bodies are not worth the CPU and the gzip header
+const compressMinBytes = 1024
+
+// encoders are the content codings we produce, in order of preference. The standard library
+// has no Brotli encoder, so br is negotiated away until one is vendored.
+var encoders = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{name: "gzip", pool: &sync.Pool{New: func() any {
+		zw, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return zw
+	}}},
+}
+
+// Compress negotiates Accept-Encoding and compresses JSON and text bodies of at least
+// compressMinBytes. Other types (export archives) are passed through untouched.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coding := negotiate(r.Header.Get("Accept-Encoding"))
+		if coding < 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, coding: coding, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate returns the index in encoders of the coding to use, -1 for none. A coding named
+// with q=0 is refused even when * allows everything else.
+func negotiate(acceptEncoding string) int {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if name != "" {
+			accepted[name] = q
+		}
+	}
+
+	best, bestQ := -1, 0.0
+	for i, e := range encoders {
+		q, ok := accepted[e.name]
+		if !ok {
+			q = accepted["*"]
+		}
+		// Earlier encoders win ties
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// compressWriter holds back the first compressMinBytes to decide; a Flush (streamed arrays)
+// decides at once
+type compressWriter struct {
+	http.ResponseWriter
+	coding  int
+	status  int
+	wrote   bool // WriteHeader called by the handler
+	decided bool
+	zw      *gzip.Writer
+	pending []byte
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	w.status = code
+	h := w.Header()
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if !w.decided {
+		w.pending = append(w.pending, b...)
+		if len(w.pending) < compressMinBytes {
+			return len(b), nil
+		}
+		w.decide(true)
+		return len(b), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the header, compressed or not, and whatever was held back
+func (w *compressWriter) decide(compress bool) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	h := w.Header()
+	if compressible(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if compress {
+		h.Set("Content-Encoding", encoders[w.coding].name)
+		h.Del("Content-Length")
+		// A strong ETag names the identity encoding's bytes
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.zw = encoders[w.coding].pool.Get().(*gzip.Writer)
+		w.zw.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.pending) > 0 {
+		if w.zw != nil {
+			w.zw.Write(w.pending)
+		} else {
+			w.ResponseWriter.Write(w.pending)
+		}
+		w.pending = nil
+	}
+}
+
+func (w *compressWriter) Flush() {
+	w.decide(w.wrote && compressible(w.Header().Get("Content-Type")))
+	if w.zw != nil {
+		w.zw.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close ends the response: a short body goes out uncompressed
+func (w *compressWriter) Close() {
+	if !w.wrote {
+		return // nothing written; the server sends its default 200
+	}
+	w.decide(false)
+	if w.zw != nil {
+		w.zw.Close()
+		encoders[w.coding].pool.Put(w.zw)
+		w.zw = nil
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
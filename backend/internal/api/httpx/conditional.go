@@ -0,0 +1,82 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Conditional gives successful GET and HEAD responses a strong ETag of their body and answers
+// 304 Not Modified when If-None-Match already names it. The handler still runs; what is saved
+// is sending the body again. Responses without their own Cache-Control must be revalidated,
+// and vary with the credentials.
+func Conditional(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(buf, r)
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(buf.body.Bytes())
+		etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		header := w.Header()
+		header.Set("ETag", etag)
+		if header.Get("Cache-Control") == "" {
+			header.Set("Cache-Control", "private, no-cache")
+			header.Add("Vary", "Authorization, Cookie")
+		}
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+// etagMatches is the weak comparison If-None-Match uses: a W/ prefix is ignored, since the
+// compressing middleware weakens our tags
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferWriter holds status and body back; headers go to the real writer's map
+type bufferWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.wrote = true
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Flush is a no-op: the ETag needs the whole body first
+func (w *bufferWriter) Flush() {}
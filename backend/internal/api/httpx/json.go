@@ -0,0 +1,59 @@
+// Package httpx holds what every handler package shares for writing responses: JSON and
+// problem bodies, conditional GET, compression and streamed JSON arrays.
+package httpx
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// WriteJSON answers status with v as JSON. HTML characters are not escaped: the content type is
+// never sniffed (nosniff) and authorization URLs keep their & readable.
+func WriteJSON(w http.ResponseWriter, v any, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Println("write json:", err)
+	}
+}
+
+// Problem is the JSON body of every error response: a machine-readable code a client acts on,
+// and for most a message for people
+type Problem struct {
+	Error   string         `json:"error"` // e.g. invalid_field
+	Message string         `json:"message,omitempty"`
+	Field   string         `json:"field,omitempty"`
+	Reason  string         `json:"reason,omitempty"`
+	Fields  []FieldProblem `json:"fields,omitempty"`
+}
+
+// FieldProblem is one invalid request field; Reason is a code such as "required"
+type FieldProblem struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// WriteProblem answers status with p
+func WriteProblem(w http.ResponseWriter, p Problem, status int) {
+	WriteJSON(w, p, status)
+}
+
+// WriteError answers status with the error code and message, the JSON counterpart of http.Error
+func WriteError(w http.ResponseWriter, code, message string, status int) {
+	WriteProblem(w, Problem{Error: code, Message: message}, status)
+}
+
+// WriteFieldErrors answers 400 invalid_field. Field and Reason repeat the first problem for
+// clients that read only those.
+func WriteFieldErrors(w http.ResponseWriter, problems []FieldProblem) {
+	WriteProblem(w, Problem{
+		Error:  "invalid_field",
+		Field:  problems[0].Field,
+		Reason: problems[0].Reason,
+		Fields: problems,
+	}, http.StatusBadRequest)
+}
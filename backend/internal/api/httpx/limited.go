@@ -0,0 +1,21 @@
+package httpx
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/ratelimit"
+)
+
+// WriteLimited answers 429 with Retry-After when err is a *ratelimit.LimitedError
+func WriteLimited(w http.ResponseWriter, err error) bool {
+	var le *ratelimit.LimitedError
+	if !errors.As(err, &le) {
+		return false
+	}
+	secs := int(le.RetryAfter.Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	WriteError(w, "too_many_requests", "too many attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
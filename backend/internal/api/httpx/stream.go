@@ -0,0 +1,112 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Elements written between flushes of an ArrayWriter
+const streamFlushEvery = 100
+
+// ArrayWriter streams a JSON array one element at a time, so a long list is never encoded
+// into a single buffer. The status is sent up front: an error half way can only be logged,
+// and the client sees a truncated (invalid) document.
+type ArrayWriter struct {
+	w       http.ResponseWriter
+	buf     bytes.Buffer
+	enc     *json.Encoder
+	n       int
+	closing string
+	err     error
+}
+
+// StreamArray answers status with a JSON object whose array member field is filled by Write,
+// after the members in fields. An empty field streams a bare array.
+func StreamArray(w http.ResponseWriter, status int, field string, fields map[string]any) (*ArrayWriter, error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	a := &ArrayWriter{w: w, closing: "]\n"}
+	a.enc = json.NewEncoder(&a.buf)
+	a.enc.SetEscapeHTML(false)
+
+	if field == "" {
+		return a, a.raw("[")
+	}
+	a.closing = "]}\n"
+	if err := a.raw("{"); err != nil {
+		return a, err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := a.member(name); err != nil {
+			return a, err
+		}
+		b, err := json.Marshal(fields[name])
+		if err != nil {
+			return a, err
+		}
+		if err := a.raw(string(b) + ","); err != nil {
+			return a, err
+		}
+	}
+	if err := a.member(field); err != nil {
+		return a, err
+	}
+	return a, a.raw("[")
+}
+
+// Write appends v to the array
+func (a *ArrayWriter) Write(v any) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.buf.Reset()
+	if a.n > 0 {
+		a.buf.WriteByte(',')
+	}
+	if err := a.enc.Encode(v); err != nil {
+		a.err = err
+		return err
+	}
+	// Encode ends each element with a newline
+	if _, err := a.w.Write(bytes.TrimSuffix(a.buf.Bytes(), []byte("\n"))); err != nil {
+		a.err = err
+		return err
+	}
+	a.n++
+	if a.n%streamFlushEvery == 0 {
+		http.NewResponseController(a.w).Flush()
+	}
+	return nil
+}
+
+// Close ends the array and the object around it
+func (a *ArrayWriter) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	return a.raw(a.closing)
+}
+
+func (a *ArrayWriter) member(name string) error {
+	b, err := json.Marshal(name)
+	if err != nil {
+		return err
+	}
+	return a.raw(string(b) + ":")
+}
+
+func (a *ArrayWriter) raw(s string) error {
+	if a.err != nil {
+		return a.err
+	}
+	_, a.err = a.w.Write([]byte(s))
+	return a.err
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the remote IP of the request without the port.
+// X-Forwarded-For is ignored on purpose: it is client controlled unless a trusted proxy sets it.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CORSConfig lists the browser origins allowed to call the API (the React frontend)
+type CORSConfig struct {
+	AllowedOrigins   []string // exact origins, or "*" without credentials
+	AllowCredentials bool     // needed for cookie sessions
+	MaxAge           time.Duration
+}
+
+var (
+	corsMethods = "GET, POST, PUT, PATCH, DELETE"
+	// traceparent/tracestate let the frontend join its traces to ours
+	corsHeaders = "Authorization, Content-Type, Idempotency-Key, X-CSRF-Token, traceparent, tracestate"
+	corsExpose  = "Idempotent-Replayed, Retry-After, X-CSRF-Token"
+)
+
+// CORS answers preflight requests itself and adds the CORS headers to allowed origins.
+// Requests from other origins pass through without them, so browsers block the response.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	wildcard := slices.Contains(cfg.AllowedOrigins, "*")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+
+			allowed := wildcard || slices.Contains(cfg.AllowedOrigins, origin)
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !allowed {
+				if preflight {
+					http.Error(w, "origin not allowed", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			if wildcard && !cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", corsMethods)
+				h.Set("Access-Control-Allow-Headers", corsHeaders)
+				h.Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Expose-Headers", corsExpose)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/request"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	// ReplayedHeader marks a response answered from the stored one
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKey = 255
+	// Larger responses are sent but not stored; a retry then runs again
+	maxStoredResponse = 256 << 10
+	// A first request still unfinished after this is taken to have died with its instance;
+	// well above the longest route timeout
+	idempotencyStaleAfter = time.Minute
+)
+
+// Response headers kept for a replay; the rest are set again by the middleware around us.
+// Set-Cookie is not among them: credentials are not stored.
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "Cache-Control", "Location", "Retry-After"}
+
+// IdempotencyStore keeps keys per user (repo.IdempotencyRepo)
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, userID, key, fingerprint string, expiresAt, staleBefore time.Time) (model.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, userID, key string, rec model.IdempotencyRecord, status int, header map[string][]string, body []byte) error
+	Release(ctx context.Context, userID, key string, rec model.IdempotencyRecord) error
+	DeleteExpired(ctx context.Context) error
+}
+
+// Idempotency honours an Idempotency-Key header on POST, PATCH and DELETE: the first request
+// with a key runs and its response is kept for window; a retry with the same key and body gets
+// that response again (Idempotent-Replayed: true) without running the handler. A retry while
+// the first one still runs is answered 409, the key reused for another request 422. Keys are
+// per user, so this must be wrapped by JWTAuth; 5xx responses are not kept.
+func Idempotency(store IdempotencyStore, window time.Duration) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	var lastPrune time.Time
+	prune := func(ctx context.Context) {
+		mu.Lock()
+		due := time.Since(lastPrune) > time.Hour
+		if due {
+			lastPrune = time.Now()
+		}
+		mu.Unlock()
+		if due {
+			if err := store.DeleteExpired(ctx); err != nil {
+				log.Println("idempotency: prune:", err)
+			}
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			userID, _ := UserIDFromContext(r.Context())
+			if key == "" || userID == "" || !idempotentMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validIdempotencyKey(key) {
+				httpx.WriteProblem(w, httpx.Problem{Error: "invalid_idempotency_key"}, http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, request.MaxBytes+1))
+			if err != nil {
+				httpx.WriteError(w, "invalid_body", "could not read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			if len(body) > request.MaxBytes {
+				// Refused by the handler's decoder anyway
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			prune(ctx)
+			fingerprint := requestFingerprint(r, body)
+			rec, reserved, err := store.Reserve(ctx, userID, key, fingerprint, time.Now().Add(window), time.Now().Add(-idempotencyStaleAfter))
+			if err != nil {
+				log.Println("idempotency: reserve:", err)
+				httpx.WriteError(w, "internal_error", "could not check idempotency key", http.StatusInternalServerError)
+				return
+			}
+			if !reserved {
+				replay(w, rec, fingerprint)
+				return
+			}
+
+			rw := &replayRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			// The request context may have timed out; the outcome must still be recorded
+			sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if rw.status >= 500 || rw.overflow {
+				err = store.Release(sctx, userID, key, rec)
+			} else {
+				err = store.Complete(sctx, userID, key, rec, rw.status, rw.header, rw.body.Bytes())
+			}
+			if err != nil {
+				log.Println("idempotency: store response:", err)
+			}
+		})
+	}
+}
+
+func idempotentMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// validIdempotencyKey allows visible ASCII, which covers UUIDs and other random tokens
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFingerprint identifies the request a key was first used for
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec model.IdempotencyRecord, fingerprint string) {
+	switch {
+	case rec.Fingerprint != fingerprint:
+		httpx.WriteProblem(w, httpx.Problem{Error: "idempotency_key_reused"}, http.StatusUnprocessableEntity)
+	case rec.Status == 0:
+		w.Header().Set("Retry-After", "1")
+		httpx.WriteProblem(w, httpx.Problem{Error: "idempotency_key_in_use"}, http.StatusConflict)
+	default:
+		for k, v := range rec.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(rec.Status)
+		w.Write(rec.Body)
+	}
+}
+
+// replayRecorder writes through and keeps what a replay needs
+type replayRecorder struct {
+	http.ResponseWriter
+	status   int
+	wrote    bool
+	header   map[string][]string
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *replayRecorder) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	w.status = code
+	w.header = make(map[string][]string)
+	for _, k := range replayedHeaders {
+		if v := w.Header().Values(k); len(v) > 0 {
+			w.header[k] = v
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *replayRecorder) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if !w.overflow {
+		if w.body.Len()+len(b) > maxStoredResponse {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *replayRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
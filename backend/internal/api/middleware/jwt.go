@@ -3,15 +3,28 @@ package middleware
 import (
 	"context"
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
 )
 
 type ctxKey string
 
-const userIDKey ctxKey = "userID"
+const (
+	userIDKey    ctxKey = "userID"
+	sessionIDKey ctxKey = "sessionID"
+	roleKey      ctxKey = "role"
+)
+
+// SessionValidator checks that the session behind a token has not been revoked. An error
+// means it could not tell.
+type SessionValidator interface {
+	SessionActive(ctx context.Context, sessionID, userID string) (bool, error)
+}
 
 func UserIDFromContext(ctx context.Context) (string, bool) {
 	v := ctx.Value(userIDKey)
@@ -19,25 +32,39 @@ func UserIDFromContext(ctx context.Context) (string, bool) {
 	return s, ok
 }
 
-func JWTAuth(secret string) func(http.Handler) http.Handler {
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	v := ctx.Value(sessionIDKey)
+	s, ok := v.(string)
+	return s, ok
+}
+
+func RoleFromContext(ctx context.Context) (string, bool) {
+	v := ctx.Value(roleKey)
+	s, ok := v.(string)
+	return s, ok
+}
+
+func JWTAuth(secret string, sessions SessionValidator) func(http.Handler) http.Handler {
 	secretBytes := []byte(secret)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			auth := r.Header.Get("Authorization")
-			if auth == "" {
-				http.Error(w, "missing Authorization header", http.StatusUnauthorized)
-				return
-			}
-
-			parts := strings.SplitN(auth, " ", 2)
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				http.Error(w, "invalid Authorization header format", http.StatusUnauthorized)
+			// The header wins; the session cookie is used in cookie session mode
+			var tokenStr string
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				parts := strings.SplitN(auth, " ", 2)
+				if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+					httpx.WriteError(w, "unauthorized", "invalid Authorization header format", http.StatusUnauthorized)
+					return
+				}
+				tokenStr = parts[1]
+			} else if c, err := r.Cookie(SessionCookie); err == nil && c.Value != "" {
+				tokenStr = c.Value
+			} else {
+				httpx.WriteError(w, "unauthorized", "missing Authorization header or session cookie", http.StatusUnauthorized)
 				return
 			}
 
-			tokenStr := parts[1]
-
 			token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
 				// Ensure HS256 (protect against alg=none)
 				if t.Method != jwt.SigningMethodHS256 {
@@ -46,24 +73,48 @@ func JWTAuth(secret string) func(http.Handler) http.Handler {
 				return secretBytes, nil
 			})
 			if err != nil || !token.Valid {
-				http.Error(w, "invalid token", http.StatusUnauthorized)
+				httpx.WriteError(w, "unauthorized", "invalid token", http.StatusUnauthorized)
 				return
 			}
 
 			claims, ok := token.Claims.(jwt.MapClaims)
 			if !ok {
-				http.Error(w, "invalid token claims", http.StatusUnauthorized)
+				httpx.WriteError(w, "unauthorized", "invalid token claims", http.StatusUnauthorized)
 				return
 			}
 
 			sub, ok := claims["sub"].(string)
 			if !ok || sub == "" {
-				http.Error(w, "token missing sub", http.StatusUnauthorized)
+				httpx.WriteError(w, "unauthorized", "token missing sub", http.StatusUnauthorized)
+				return
+			}
+
+			sid, ok := claims["sid"].(string)
+			if !ok || sid == "" {
+				httpx.WriteError(w, "unauthorized", "token missing sid", http.StatusUnauthorized)
 				return
 			}
+			active, err := sessions.SessionActive(r.Context(), sid, sub)
+			if err != nil {
+				log.Println("jwt: check session:", err)
+				httpx.WriteError(w, "session_check_failed", "could not check session", http.StatusServiceUnavailable)
+				return
+			}
+			if !active {
+				httpx.WriteError(w, "unauthorized", "session revoked", http.StatusUnauthorized)
+				return
+			}
+
+			// Tokens issued before roles existed are plain users
+			role, _ := claims["role"].(string)
+			if role == "" {
+				role = "user"
+			}
 
-			// Put userId into context for handlers to use later
+			// Put userId, sessionId and role into context for handlers to use later
 			ctx := context.WithValue(r.Context(), userIDKey, sub)
+			ctx = context.WithValue(ctx, sessionIDKey, sid)
+			ctx = context.WithValue(ctx, roleKey, role)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
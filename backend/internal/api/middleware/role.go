@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+)
+
+// RequireRole only lets requests through whose token role is one of roles.
+// Must be wrapped by JWTAuth: JWTAuth(secret, sessions)(RequireRole("admin")(h))
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := RoleFromContext(r.Context())
+			if !ok {
+				httpx.WriteError(w, "unauthorized", "missing user context", http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(roles, role) {
+				httpx.WriteError(w, "forbidden", "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// RefreshCookie carries the refresh token, only sent to /auth (refresh, logout and csrf)
+const RefreshCookie = "opl_refresh"
+
+// SessionCookies issues tokens as HttpOnly cookies instead of in the response body, so
+// browser scripts never see them. Disabled means bearer mode: tokens stay in the body.
+type SessionCookies struct {
+	Enabled  bool
+	Secure   bool // false only for plain HTTP development
+	SameSite http.SameSite
+	Domain   string // empty: host-only cookies
+}
+
+// Write sets the session, refresh and CSRF cookies and returns the CSRF token for the body
+func (c SessionCookies) Write(w http.ResponseWriter, access string, accessTTL int, refresh string, refreshTTL int) (string, error) {
+	http.SetCookie(w, c.cookie(SessionCookie, access, "/", accessTTL))
+	http.SetCookie(w, c.cookie(RefreshCookie, refresh, "/auth", refreshTTL))
+	return SetCSRFCookie(w, c.Secure, c.SameSite, refreshTTL)
+}
+
+// Clear expires the cookies, e.g. on logout
+func (c SessionCookies) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie(SessionCookie, "", "/", -1))
+	http.SetCookie(w, c.cookie(RefreshCookie, "", "/auth", -1))
+	http.SetCookie(w, &http.Cookie{Name: CSRFCookie, Path: "/", MaxAge: -1, Secure: c.Secure, SameSite: c.SameSite})
+}
+
+// RefreshToken returns the refresh token cookie, if any
+func (c SessionCookies) RefreshToken(r *http.Request) string {
+	if !c.Enabled {
+		return ""
+	}
+	ck, err := r.Cookie(RefreshCookie)
+	if err != nil {
+		return ""
+	}
+	return ck.Value
+}
+
+func (c SessionCookies) cookie(name, value, path string, maxAge int) *http.Cookie {
+	ck := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: c.SameSite,
+	}
+	if maxAge > 0 {
+		ck.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+	return ck
+}
@@ -0,0 +1,186 @@
+package oidcauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+)
+
+// oidcStateCookie binds a started login or link to the browser that started it, so a callback
+// URL with someone else's state (login CSRF, or linking an attacker's identity) is refused
+const oidcStateCookie = "opl_oidc_state"
+
+type Handler struct {
+	svc         *service.OIDCService
+	cookies     middleware.SessionCookies
+	frontendURL string
+}
+
+func NewHandler(svc *service.OIDCService, cookies middleware.SessionCookies, frontendURL string) *Handler {
+	return &Handler{svc: svc, cookies: cookies, frontendURL: frontendURL}
+}
+
+// Start returns the provider authorization URL for a login
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	h.start(w, r, "")
+}
+
+// Link returns the provider authorization URL to link it to the signed-in user (protected route)
+func (h *Handler) Link(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		httpx.WriteError(w, "unauthorized", "missing user context", http.StatusUnauthorized)
+		return
+	}
+	h.start(w, r, userID)
+}
+
+func (h *Handler) start(w http.ResponseWriter, r *http.Request, linkUserID string) {
+	ctx := r.Context()
+	provider := r.PathValue("provider")
+
+	authURL, state, err := h.svc.Start(ctx, provider, linkUserID)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownProvider) {
+			httpx.WriteError(w, "unknown_provider", err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Println("oidc start:", err)
+		httpx.WriteError(w, "provider_unavailable", "could not start sign in", http.StatusBadGateway)
+		return
+	}
+	http.SetCookie(w, h.stateCookie(provider, state, int(service.OIDCStateTTL.Seconds())))
+	httpx.WriteJSON(w, map[string]string{"authorization_url": authURL}, http.StatusOK)
+}
+
+// Callback is public: the provider redirects the browser here without our token. It sends the
+// browser on to the frontend with the outcome in the URL fragment, which is not sent to servers.
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	provider := r.PathValue("provider")
+
+	// One use only, whatever the outcome
+	ck, ckErr := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, h.stateCookie(provider, "", -1))
+
+	if e := q.Get("error"); e != "" {
+		h.finish(w, url.Values{"error": {"provider_error"}, "providerError": {e}})
+		return
+	}
+	state := q.Get("state")
+	if ckErr != nil || state == "" || subtle.ConstantTimeCompare([]byte(ck.Value), []byte(state)) != 1 {
+		h.finish(w, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	ctx := r.Context()
+
+	client := service.ClientInfo{IP: middleware.ClientIP(r), UserAgent: r.UserAgent()}
+	res, err := h.svc.Callback(ctx, provider, state, q.Get("code"), client)
+	if err != nil {
+		code := "sign_in_failed"
+		switch {
+		case errors.Is(err, service.ErrUnknownProvider):
+			code = "unknown_provider"
+		case errors.Is(err, service.ErrInvalidOIDCState):
+			code = "invalid_state"
+		case errors.Is(err, service.ErrEmailNotVerified):
+			code = "email_not_verified"
+		case errors.Is(err, service.ErrEmailNotLinked):
+			code = "email_not_linked"
+		case errors.Is(err, service.ErrIdentityInUse):
+			code = "identity_in_use"
+		case errors.Is(err, service.ErrAccountDisabled):
+			code = "account_disabled"
+		default:
+			log.Println("oidc callback:", err)
+		}
+		h.finish(w, url.Values{"error": {code}})
+		return
+	}
+
+	if res.Linked {
+		h.finish(w, url.Values{"linked": {res.Provider}})
+		return
+	}
+	expiresIn := strconv.Itoa(res.Tokens.ExpiresIn)
+	if !h.cookies.Enabled {
+		h.finish(w, url.Values{
+			"token":        {res.Tokens.AccessToken},
+			"refreshToken": {res.Tokens.RefreshToken},
+			"expiresIn":    {expiresIn},
+		})
+		return
+	}
+	// Cookie mode: tokens only in HttpOnly cookies
+	csrf, err := h.cookies.Write(w, res.Tokens.AccessToken, res.Tokens.ExpiresIn, res.Tokens.RefreshToken, res.Tokens.RefreshExpiresIn)
+	if err != nil {
+		h.finish(w, url.Values{"error": {"sign_in_failed"}})
+		return
+	}
+	h.finish(w, url.Values{"expiresIn": {expiresIn}, "csrfToken": {csrf}})
+}
+
+// finish redirects to the frontend. The body is left empty: the outcome is in Location only.
+func (h *Handler) finish(w http.ResponseWriter, outcome url.Values) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", h.frontendURL+"#"+outcome.Encode())
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// stateCookie is sent back on the provider's top-level redirect only: SameSite=Lax, and the
+// path of that provider's callback
+func (h *Handler) stateCookie(provider, state string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc/" + provider + "/callback",
+		MaxAge:   maxAge,
+		Secure:   h.cookies.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (h *Handler) Identities(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	ctx := r.Context()
+
+	ids, err := h.svc.Identities(ctx, userID)
+	if err != nil {
+		httpx.WriteError(w, "internal_error", "could not list identities", http.StatusInternalServerError)
+		return
+	}
+	if ids == nil {
+		ids = []model.Identity{}
+	}
+	httpx.WriteJSON(w, map[string]any{"identities": ids, "providers": h.svc.Providers()}, http.StatusOK)
+}
+
+func (h *Handler) Unlink(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	ctx := r.Context()
+
+	if err := h.svc.Unlink(ctx, userID, r.PathValue("provider")); err != nil {
+		switch {
+		case service.IsNoRows(err):
+			httpx.WriteError(w, "not_linked", "provider not linked", http.StatusNotFound)
+		case errors.Is(err, service.ErrLastLoginMethod):
+			httpx.WriteError(w, "last_login_method", err.Error(), http.StatusConflict)
+		default:
+			httpx.WriteError(w, "internal_error", "could not unlink provider", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
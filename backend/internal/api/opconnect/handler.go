@@ -1,10 +1,13 @@
 package opconnect
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"time"
 
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opclient"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
 )
 
@@ -19,18 +22,29 @@ func NewHandler(svc *service.OPConnectService) *Handler {
 func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok || userID == "" {
-		http.Error(w, "missing user context", http.StatusUnauthorized)
+		httpx.WriteError(w, "unauthorized", "missing user context", http.StatusUnauthorized)
 		return
 	}
 
-	ctx, cancel := contextWithTimeout(r, 15*time.Second)
-	defer cancel()
+	ctx := r.Context()
 
-	authURL, err := h.svc.Start(ctx, userID)
+	// ?env=<name> picks a non-default OP environment (e.g. sandbox next to production)
+	authURL, err := h.svc.Start(ctx, userID, r.URL.Query().Get("env"))
+	if errors.Is(err, service.ErrUnknownOPEnvironment) {
+		httpx.WriteError(w, "unknown_environment", "unknown OP environment", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, opclient.ErrCircuitOpen) {
+		w.Header().Set("Retry-After", "30")
+		httpx.WriteError(w, "bank_unavailable", "bank temporarily unavailable, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		http.Error(w, "failed to start OP connect: "+err.Error(), http.StatusBadRequest)
+		// Errors may carry OP or signer response bodies; they stay in the log
+		log.Println("op connect start:", err)
+		httpx.WriteError(w, "connect_failed", "could not start the bank connection, try again later", http.StatusBadGateway)
 		return
 	}
 
-	writeJSON(w, map[string]string{"authorization_url": authURL}, http.StatusOK)
+	httpx.WriteJSON(w, map[string]string{"authorization_url": authURL}, http.StatusOK)
 }
@@ -1,21 +0,0 @@
-package opconnect
-
-import (
-	"context"
-	"encoding/json"
-	"net/http"
-	"time"
-)
-
-func writeJSON(w http.ResponseWriter, v any, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-
-	enc := json.NewEncoder(w)
-	enc.SetEscapeHTML(false) // Keeps & as &, not \u0026
-	_ = enc.Encode(v)
-}
-
-func contextWithTimeout(r *http.Request, d time.Duration) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(r.Context(), d)
-}
@@ -0,0 +1,168 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/metrics"
+)
+
+// Bodies larger than this are passed through unchecked in log mode
+const maxCheckedBody = 1 << 20
+
+// Contract checks each response of a documented route: its status must be documented, its
+// content type match and a JSON body validate against the schema. It must wrap the router,
+// which sets r.Pattern. Violations are logged and counted; enforce also answers 500 in their
+// place, which buffers every response and so is meant for development and CI.
+func (d *Document) Contract(enforce bool) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	violations := make(map[string]float64) // by route name
+	metrics.Counter("opl_openapi_contract_violations_total", "Responses that did not match the OpenAPI document, per route.",
+		func() []metrics.Sample {
+			mu.Lock()
+			defer mu.Unlock()
+			out := make([]metrics.Sample, 0, len(violations))
+			for name, n := range violations {
+				out = append(out, metrics.Sample{Labels: map[string]string{"route": name}, Value: n})
+			}
+			return out
+		})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &recorder{ResponseWriter: w, buffer: enforce, header: make(http.Header), status: http.StatusOK}
+			if !enforce {
+				rec.header = w.Header()
+			}
+			next.ServeHTTP(rec, r)
+
+			dr, ok := d.routes[r.Pattern]
+			var problems []string
+			if ok {
+				problems = d.check(dr.op, rec)
+			}
+			if len(problems) > 0 {
+				mu.Lock()
+				violations[dr.route.Name]++
+				mu.Unlock()
+				log.Printf("openapi contract: %s answered %d: %s", dr.route.Name, rec.status, strings.Join(problems, "; "))
+				if enforce {
+					httpx.WriteError(w, "contract_violation", "response does not match the API description: "+strings.Join(problems, "; "), http.StatusInternalServerError)
+					return
+				}
+			}
+			if enforce {
+				rec.flush()
+			}
+		})
+	}
+}
+
+func (d *Document) check(op Operation, rec *recorder) []string {
+	resp, ok := op.Responses[rec.status]
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented", rec.status)}
+	}
+	if rec.truncated {
+		return nil
+	}
+	body := rec.body.Bytes()
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			return []string{"body sent on a response documented without one"}
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(rec.header.Get("Content-Type"))
+	schema, ok := resp.Content[mediaType]
+	if !ok {
+		documented := make([]string, 0, len(resp.Content))
+		for t := range resp.Content {
+			documented = append(documented, t)
+		}
+		sort.Strings(documented)
+		return []string{fmt.Sprintf("content type %q, documented %s", mediaType, strings.Join(documented, ", "))}
+	}
+	if mediaType != "application/json" || schema == nil {
+		return nil
+	}
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return []string{"invalid JSON: " + err.Error()}
+	}
+	return d.components.Validate(schema, v)
+}
+
+// recorder keeps status, headers and body for the check. In log mode it writes through and
+// stops keeping the body past maxCheckedBody; when buffering nothing reaches the client until
+// flush.
+type recorder struct {
+	http.ResponseWriter
+	buffer    bool
+	header    http.Header
+	status    int
+	wrote     bool
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *recorder) Header() http.Header {
+	return w.header
+}
+
+func (w *recorder) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	w.status = code
+	if !w.buffer {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.buffer {
+		return w.body.Write(b)
+	}
+	if !w.truncated {
+		if w.body.Len()+len(b) > maxCheckedBody {
+			w.truncated = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) flush() {
+	for k, v := range w.header {
+		w.ResponseWriter.Header()[k] = v
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// Flush passes through in log mode; a buffered response must not reach the client early
+func (w *recorder) Flush() {
+	if !w.buffer {
+		http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+func (w *recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
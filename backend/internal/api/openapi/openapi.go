@@ -0,0 +1,353 @@
+// Package openapi describes the HTTP API as an OpenAPI 3.1 document, served at /openapi.json
+// for the frontend's generated client, and checks at runtime that handlers answer what the
+// document says.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+)
+
+// Operation describes one route; the table in operations.go has one per route name
+type Operation struct {
+	Summary string
+	Params  []Param // query parameters; path parameters come from the route pattern
+	Body    *Schema // JSON request body, nil when the route reads none
+	// OptionalBody marks a body that may be left out, e.g. the refresh token in cookie mode
+	OptionalBody bool
+	Responses    map[int]Response
+}
+
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+	Schema      *Schema
+}
+
+// Response is one documented status: its body schema per media type, none for no body
+type Response struct {
+	Description string
+	Content     map[string]*Schema
+}
+
+func JSON(description string, s *Schema) Response {
+	return Response{Description: description, Content: map[string]*Schema{"application/json": s}}
+}
+
+func Text(description string) Response {
+	return Response{Description: description, Content: map[string]*Schema{"text/plain": String()}}
+}
+
+// Error is an error body written with httpx.WriteError, its error member one of codes
+func Error(description string, codes ...string) Response {
+	return JSON(description, Object(map[string]*Schema{
+		"error":   Enum(codes...),
+		"message": String(),
+	}, "error"))
+}
+
+func File(description, contentType string) Response {
+	return Response{Description: description, Content: map[string]*Schema{contentType: {Type: "string", Format: "binary"}}}
+}
+
+func Empty(description string) Response {
+	return Response{Description: description}
+}
+
+// Or documents a status answered in either form, e.g. an error code or a JSON field error.
+// Two schemas for one media type become a oneOf.
+func (r Response) Or(other Response) Response {
+	content := make(map[string]*Schema, len(r.Content)+len(other.Content))
+	for _, c := range []map[string]*Schema{r.Content, other.Content} {
+		for mediaType, s := range c {
+			if prev, ok := content[mediaType]; ok {
+				s = OneOf(prev, s)
+			}
+			content[mediaType] = s
+		}
+	}
+	return Response{Description: r.Description + "; " + other.Description, Content: content}
+}
+
+// Info fills the document's info and servers
+type Info struct {
+	Title     string
+	Version   string
+	ServerURL string
+}
+
+// Document is the API description. Build ties it to the registered routes; until then it
+// serves nothing and checks nothing.
+type Document struct {
+	info       Info
+	components *Components
+	operations map[string]Operation
+
+	routes map[string]documented // by ServeMux pattern
+	spec   []byte
+}
+
+type documented struct {
+	route api.Route
+	op    Operation
+}
+
+func NewDocument(info Info) *Document {
+	c := NewComponents()
+	return &Document{info: info, components: c, operations: operations(c)}
+}
+
+// Build documents routes and fails when a route has no operation or an operation no route,
+// so the document cannot silently fall behind the router
+func (d *Document) Build(routes []api.Route) error {
+	var problems []string
+	byPattern := make(map[string]documented, len(routes))
+	seen := make(map[string]bool)
+	for _, rt := range routes {
+		op, ok := d.operations[rt.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("route %s (%s) is not documented", rt.Pattern(), rt.Name))
+			continue
+		}
+		seen[rt.Name] = true
+		byPattern[rt.Pattern()] = documented{route: rt, op: withSharedResponses(rt, op)}
+	}
+	for name := range d.operations {
+		if !seen[name] {
+			problems = append(problems, fmt.Sprintf("operation %s has no route", name))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi: %s", strings.Join(problems, "; "))
+	}
+
+	spec, err := json.Marshal(d.document(byPattern))
+	if err != nil {
+		return fmt.Errorf("openapi: %w", err)
+	}
+	d.routes = byPattern
+	d.spec = spec
+	return nil
+}
+
+// Serve answers GET /openapi.json
+func (d *Document) Serve(w http.ResponseWriter, r *http.Request) {
+	if d.spec == nil {
+		httpx.WriteError(w, "not_ready", "API description not built", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(d.spec)
+}
+
+// withSharedResponses adds the answers of the group middleware, which handlers never see, and
+// of request body decoding
+func withSharedResponses(rt api.Route, op Operation) Operation {
+	responses := make(map[int]Response, len(op.Responses)+4)
+	for code, resp := range op.Responses {
+		responses[code] = resp
+	}
+	add := func(code int, resp Response) {
+		if _, ok := responses[code]; !ok {
+			responses[code] = resp
+		}
+	}
+	// merge keeps the operation's own answer for code alongside resp
+	merge := func(code int, resp Response) {
+		if own, ok := responses[code]; ok {
+			resp = own.Or(resp)
+		}
+		responses[code] = resp
+	}
+	if rt.Group != "public" {
+		merge(http.StatusUnauthorized, Error("Missing, invalid or revoked access token", "unauthorized"))
+		merge(http.StatusServiceUnavailable, Error("The session could not be checked", "session_check_failed"))
+	}
+	if rt.Group == "staff" || rt.Group == "admin" {
+		merge(http.StatusForbidden, Error("The caller's role may not use this endpoint", "forbidden"))
+	}
+	if rt.Method != http.MethodGet && rt.Method != http.MethodHead {
+		merge(http.StatusForbidden, Error("Cookie session without a matching X-CSRF-Token header", "csrf_failed"))
+	}
+	if idempotent(rt) {
+		idempotencyError := Ref("IdempotencyError")
+		merge(http.StatusBadRequest, JSON("Malformed Idempotency-Key", idempotencyError))
+		merge(http.StatusConflict, JSON("A request with this Idempotency-Key is still running", idempotencyError))
+		merge(http.StatusUnprocessableEntity, JSON("The Idempotency-Key was used for a different request", idempotencyError))
+		add(http.StatusInternalServerError, Error("The Idempotency-Key could not be checked", "internal_error"))
+	}
+	if rt.Conditional {
+		add(http.StatusNotModified, Empty("The copy named by If-None-Match is current"))
+	}
+	if op.Body != nil {
+		requestError := Ref("RequestError")
+		merge(http.StatusBadRequest, JSON("Malformed body or invalid fields", requestError))
+		add(http.StatusRequestEntityTooLarge, JSON("Body over the size limit", requestError))
+		add(http.StatusUnsupportedMediaType, JSON("Content-Type is not application/json", requestError))
+	}
+	op.Responses = responses
+	return op
+}
+
+// idempotent tells whether the route honours Idempotency-Key: state-changing methods behind
+// authentication, as keys are kept per user
+func idempotent(rt api.Route) bool {
+	switch rt.Method {
+	case http.MethodPost, http.MethodPatch, http.MethodDelete:
+		return rt.Group != "public"
+	}
+	return false
+}
+
+// The wire format of the document
+
+type specDocument struct {
+	OpenAPI    string                              `json:"openapi"`
+	Info       specInfo                            `json:"info"`
+	Servers    []specServer                        `json:"servers,omitempty"`
+	Paths      map[string]map[string]specOperation `json:"paths"`
+	Components specComponents                      `json:"components"`
+}
+
+type specInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type specServer struct {
+	URL string `json:"url"`
+}
+
+type specOperation struct {
+	OperationID string                  `json:"operationId"`
+	Summary     string                  `json:"summary,omitempty"`
+	Tags        []string                `json:"tags"`
+	Parameters  []specParameter         `json:"parameters,omitempty"`
+	RequestBody *specRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]specResponse `json:"responses"`
+	Security    []map[string][]string   `json:"security,omitempty"`
+}
+
+type specParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type specRequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]specMedia `json:"content"`
+}
+
+type specMedia struct {
+	Schema *Schema `json:"schema"`
+}
+
+type specResponse struct {
+	Description string               `json:"description"`
+	Content     map[string]specMedia `json:"content,omitempty"`
+}
+
+type specComponents struct {
+	Schemas         map[string]*Schema            `json:"schemas"`
+	SecuritySchemes map[string]specSecurityScheme `json:"securitySchemes"`
+}
+
+type specSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+func (d *Document) document(routes map[string]documented) specDocument {
+	doc := specDocument{
+		OpenAPI: "3.1.0",
+		Info:    specInfo{Title: d.info.Title, Version: d.info.Version},
+		Paths:   make(map[string]map[string]specOperation),
+		Components: specComponents{
+			Schemas: d.components.Schemas,
+			SecuritySchemes: map[string]specSecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"cookieAuth": {Type: "apiKey", In: "cookie", Name: "opl_session",
+					Description: "Cookie session mode; unsafe methods also need the X-CSRF-Token header"},
+			},
+		},
+	}
+	if d.info.ServerURL != "" {
+		doc.Servers = []specServer{{URL: d.info.ServerURL}}
+	}
+
+	for _, dr := range routes {
+		rt, op := dr.route, dr.op
+		tag, _, _ := strings.Cut(rt.Name, ".")
+		so := specOperation{
+			OperationID: rt.Name,
+			Summary:     op.Summary,
+			Tags:        []string{tag},
+			Responses:   make(map[string]specResponse, len(op.Responses)),
+		}
+		for _, name := range pathParams(rt.Path) {
+			so.Parameters = append(so.Parameters, specParameter{Name: name, In: "path", Required: true, Schema: String()})
+		}
+		for _, p := range op.Params {
+			so.Parameters = append(so.Parameters, specParameter{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: p.Schema})
+		}
+		if idempotent(rt) {
+			so.Parameters = append(so.Parameters, specParameter{Name: "Idempotency-Key", In: "header",
+				Description: "Client chosen key; a retry with the same key and body gets the first response again", Schema: String()})
+		}
+		if rt.Conditional {
+			so.Parameters = append(so.Parameters, specParameter{Name: "If-None-Match", In: "header",
+				Description: "ETag of a copy the client holds; answered 304 while it is current", Schema: String()})
+		}
+		if op.Body != nil {
+			so.RequestBody = &specRequestBody{Required: !op.OptionalBody, Content: map[string]specMedia{"application/json": {Schema: op.Body}}}
+		}
+		for code, resp := range op.Responses {
+			sr := specResponse{Description: resp.Description}
+			for mediaType, s := range resp.Content {
+				if sr.Content == nil {
+					sr.Content = make(map[string]specMedia)
+				}
+				sr.Content[mediaType] = specMedia{Schema: s}
+			}
+			so.Responses[strconv.Itoa(code)] = sr
+		}
+		if rt.Group != "public" {
+			so.Security = []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}}
+		}
+
+		if doc.Paths[rt.Path] == nil {
+			doc.Paths[rt.Path] = make(map[string]specOperation)
+		}
+		doc.Paths[rt.Path][strings.ToLower(rt.Method)] = so
+	}
+	return doc
+}
+
+// pathParams lists the {name} wildcards of a ServeMux path
+func pathParams(path string) []string {
+	var names []string
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			names = append(names, strings.TrimSuffix(strings.Trim(seg, "{}"), "..."))
+		}
+	}
+	return names
+}
@@ -0,0 +1,458 @@
+package openapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/certs"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oprecord"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+)
+
+// operations describes every route by its name. Response types are reflected from the Go types
+// the handlers encode; request bodies are written out, as the handlers' request types are
+// private to their packages.
+func operations(c *Components) map[string]Operation {
+	// Models
+	user := c.Define("User", model.User{})
+	c.Schemas["User"].Properties["role"] = Enum(model.RoleUser, model.RoleSupport, model.RoleAdmin)
+	c.Define("Connection", model.Connection{})
+	session := c.Define("Session", model.Session{})
+	dataExport := c.Define("DataExport", model.DataExport{})
+	c.Schemas["DataExport"].Properties["status"] = Enum(model.ExportPending, model.ExportReady, model.ExportFailed)
+	identity := c.Define("Identity", model.Identity{})
+	activity := c.Define("ActivityEvent", model.ActivityEvent{})
+	overview := c.Define("UserOverview", service.UserOverview{})
+	c.Define("OPRequest", oprecord.Request{})
+	c.Define("OPResponse", oprecord.Response{})
+	interaction := c.Define("OPInteraction", oprecord.Interaction{})
+	c.Define("OPFixture", oprecord.Fixture{})
+	fixtures := c.Define("OPFixtureFile", oprecord.FixtureFile{})
+	certificate := c.Define("Certificate", certs.Info{})
+	jwk := c.Define("JWK", opjwt.JWK{})
+
+	// Results and errors
+	bearerTokens := c.Add("Tokens", Object(map[string]*Schema{
+		"token":        String().Describe("Access token (JWT), sent as Authorization: Bearer"),
+		"refreshToken": String(),
+		"expiresIn":    Integer().Describe("Access token lifetime in seconds"),
+	}, "token", "refreshToken", "expiresIn").Describe("Bearer session mode"))
+	cookieSession := c.Add("CookieSession", Object(map[string]*Schema{
+		"expiresIn": Integer().Describe("Access token lifetime in seconds"),
+		"csrfToken": String().Describe("Echo in X-CSRF-Token on unsafe requests"),
+	}, "expiresIn", "csrfToken").Describe("Cookie session mode: the tokens are in HttpOnly cookies"))
+	signedIn := OneOf(bearerTokens, cookieSession)
+	authURL := c.Add("AuthorizationURL", Object(map[string]*Schema{
+		"authorization_url": String().Describe("Where to send the browser"),
+	}, "authorization_url"))
+	weakPassword := c.Add("WeakPassword", Object(map[string]*Schema{
+		"error":   Enum("weak_password"),
+		"reasons": Array(String()),
+	}, "error", "reasons"))
+	fieldProblem := Object(map[string]*Schema{
+		"field":  String(),
+		"reason": String().Describe("Machine-readable code, e.g. required or invalid_email"),
+	}, "field", "reason")
+	c.Add("RequestError", Object(map[string]*Schema{
+		"error":  Enum("invalid_body", "invalid_field", "body_too_large", "unsupported_media_type"),
+		"field":  String().Describe("First entry of fields"),
+		"reason": String(),
+		"fields": Array(fieldProblem),
+	}, "error").Describe("A request body that could not be decoded or failed validation"))
+	c.Add("IdempotencyError", Object(map[string]*Schema{
+		"error": Enum("invalid_idempotency_key", "idempotency_key_in_use", "idempotency_key_reused"),
+	}, "error"))
+	readiness := c.Add("Readiness", Object(map[string]*Schema{
+		"ready": Boolean(),
+		"checks": Array(Object(map[string]*Schema{
+			"name":        String(),
+			"ok":          Boolean(),
+			"detail":      String(),
+			"certificate": certificate,
+		}, "name", "ok")),
+	}, "ready", "checks"))
+
+	// Query parameters
+	limit := func(max int) Param {
+		return Param{Name: "limit", Description: "1.." + strconv.Itoa(max), Schema: Integer()}
+	}
+	interactionParams := func(max int) []Param {
+		return []Param{
+			{Name: "user", Description: "User id", Schema: &Schema{Type: "string", Format: "uuid"}},
+			{Name: "from", Schema: DateTime()},
+			{Name: "to", Schema: DateTime()},
+			limit(max),
+		}
+	}
+
+	tooMany := Error("Too many attempts; see Retry-After", "too_many_requests")
+	failed := Error("Unexpected server error", "internal_error")
+
+	return map[string]Operation{
+		"health.livez": {
+			Summary:   "Liveness probe",
+			Responses: map[int]Response{http.StatusOK: Text("The process is up")},
+		},
+		"health.readyz": {
+			Summary: "Readiness probe",
+			Responses: map[int]Response{
+				http.StatusOK:                 JSON("Ready", readiness),
+				http.StatusServiceUnavailable: JSON("A check failed or the instance is draining", readiness),
+			},
+		},
+		"openapi.document": {
+			Summary: "This API description",
+			Responses: map[int]Response{
+				http.StatusOK:                 JSON("OpenAPI 3.1 document", Any()),
+				http.StatusServiceUnavailable: Error("Not built yet", "not_ready"),
+			},
+		},
+		"wellknown.tppJWKS": {
+			Summary: "Our QSEAL public keys, the JWKS URI of the software statement",
+			Responses: map[int]Response{
+				http.StatusOK: JSON("Key set", Object(map[string]*Schema{"keys": Array(jwk)}, "keys")),
+			},
+		},
+
+		"auth.signup": {
+			Summary: "Create an account; a verification email is sent",
+			Body: Object(map[string]*Schema{
+				"email":    String(),
+				"password": String(),
+			}, "email", "password"),
+			Responses: map[int]Response{
+				http.StatusCreated: JSON("Created", Object(map[string]*Schema{
+					"id":            String(),
+					"email":         String(),
+					"emailVerified": Boolean(),
+					"createdAt":     DateTime(),
+				}, "id", "email", "emailVerified", "createdAt")),
+				http.StatusBadRequest:          JSON("Password rejected by the policy", weakPassword),
+				http.StatusConflict:            Error("Email already registered", "email_taken"),
+				http.StatusTooManyRequests:     tooMany,
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"auth.login": {
+			Summary: "Sign in with email and password",
+			Body: Object(map[string]*Schema{
+				"email":    String(),
+				"password": String(),
+			}, "email", "password"),
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Signed in", signedIn),
+				http.StatusUnauthorized:        Error("Invalid credentials", "invalid_credentials"),
+				http.StatusForbidden:           Error("Account disabled", "account_disabled"),
+				http.StatusTooManyRequests:     tooMany,
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"auth.refresh": {
+			Summary:      "Rotate the refresh token for a new access token",
+			Body:         Object(map[string]*Schema{"refreshToken": String()}, "refreshToken"),
+			OptionalBody: true, // cookie mode sends the refresh cookie instead
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("New tokens", signedIn),
+				http.StatusUnauthorized:        Error("Invalid, expired or reused refresh token", "invalid_refresh_token"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"auth.verifyEmail": {
+			Summary: "Confirm an email address with the token from the verification email",
+			Body:    Object(map[string]*Schema{"token": String()}, "token"),
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Verified"),
+				http.StatusBadRequest:          Error("Invalid or expired token", "invalid_token"),
+				http.StatusConflict:            Error("Email already registered", "email_taken"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"auth.forgotPassword": {
+			Summary: "Send a password reset email; answers 202 whether or not the account exists",
+			Body:    Object(map[string]*Schema{"email": String()}, "email"),
+			Responses: map[int]Response{
+				http.StatusAccepted:            Empty("Accepted"),
+				http.StatusTooManyRequests:     tooMany,
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"auth.resetPassword": {
+			Summary: "Set a new password with the token from the reset email",
+			Body: Object(map[string]*Schema{
+				"token":       String(),
+				"newPassword": String(),
+			}, "token", "newPassword"),
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Password changed, all sessions revoked"),
+				http.StatusBadRequest:          Error("Invalid or expired token", "invalid_token").Or(JSON("Password rejected by the policy", weakPassword)),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"auth.logout": {
+			Summary:      "Revoke the session of the refresh cookie or body token, else of the access token",
+			Body:         Object(map[string]*Schema{"refreshToken": String()}, "refreshToken"),
+			OptionalBody: true, // cookie mode sends the refresh cookie; bearer clients may send the access token alone
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Signed out"),
+				http.StatusUnauthorized:        Error("No refresh token and a missing, invalid or revoked access token", "unauthorized"),
+				http.StatusServiceUnavailable:  Error("The session could not be checked", "session_check_failed"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"auth.csrf": {
+			Summary: "Issue a new CSRF token in cookie mode, e.g. after the opl_csrf cookie was lost",
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("New token, also set as the opl_csrf cookie", Object(map[string]*Schema{"csrfToken": String()}, "csrfToken")),
+				http.StatusNotFound:            Error("Cookie sessions are disabled", "cookie_sessions_disabled"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+
+		"oidc.start": {
+			Summary: "Start a social login; sets the state cookie the callback checks",
+			Responses: map[int]Response{
+				http.StatusOK:         JSON("Provider authorization URL", authURL),
+				http.StatusNotFound:   Error("Unknown provider", "unknown_provider"),
+				http.StatusBadGateway: Error("Provider discovery failed", "provider_unavailable"),
+			},
+		},
+		"oidc.callback": {
+			Summary: "Provider redirect target: signs in, or completes a link, then redirects to the frontend",
+			Params: []Param{
+				{Name: "state", Required: true, Schema: String()},
+				{Name: "code", Schema: String()},
+				{Name: "error", Description: "Set by the provider when the user declined", Schema: String()},
+			},
+			Responses: map[int]Response{
+				http.StatusSeeOther: Empty("To OIDC_FRONTEND_URL. The fragment holds error (a code), linked (the provider), " +
+					"token, refreshToken and expiresIn in bearer mode, or expiresIn and csrfToken in cookie mode"),
+			},
+		},
+
+		"privacy.downloadExport": {
+			Summary: "Download a GDPR export archive; the link token is the credential",
+			Responses: map[int]Response{
+				http.StatusOK:                  File("Export archive", "application/zip"),
+				http.StatusNotFound:            Error("Unknown or expired link", "export_not_found"),
+				http.StatusGone:                Error("Archive file missing", "export_gone"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"opconnect.callback": {
+			Summary:   "OP redirect target after the user authorized access",
+			Responses: map[int]Response{http.StatusOK: Text("Acknowledgement")},
+		},
+		"opconnect.start": {
+			Summary: "Start connecting an OP bank account",
+			Params:  []Param{{Name: "env", Description: "OP environment name, the default one when empty", Schema: String()}},
+			Responses: map[int]Response{
+				http.StatusOK:                 JSON("OP authorization URL", authURL),
+				http.StatusBadRequest:         Error("Unknown OP environment", "unknown_environment"),
+				http.StatusBadGateway:         Error("OP, the QSEAL signer or the database failed; details are only logged", "connect_failed"),
+				http.StatusServiceUnavailable: Error("OP circuit open; see Retry-After", "bank_unavailable"),
+			},
+		},
+
+		"me.get": {
+			Summary: "The caller's profile",
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Profile", user),
+				http.StatusNotFound:            Error("User not found", "user_not_found"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.update": {
+			Summary: "Update profile fields; absent or null fields are unchanged",
+			Body: Object(map[string]*Schema{
+				"displayName":       Nullable(String()),
+				"locale":            Nullable(String()),
+				"preferredCurrency": Nullable(String().Describe("ISO 4217 code")),
+				"timezone":          Nullable(String().Describe("IANA time zone")),
+			}),
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Updated profile", user),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.delete": {
+			Summary:      "Revoke all bank consents and erase the account",
+			Body:         Object(map[string]*Schema{"password": String()}),
+			OptionalBody: true, // accounts without a password (social login only) sign in again instead
+			Responses: map[int]Response{
+				http.StatusNoContent:       Empty("Deleted"),
+				http.StatusForbidden:       Error("Password is wrong, or a social-login-only account did not sign in within the last 10 minutes", "wrong_password", "sign_in_required"),
+				http.StatusTooManyRequests: tooMany,
+				http.StatusBadGateway:      Error("Consent revocation failed; nothing was deleted, try again", "consent_revocation_failed"),
+			},
+		},
+		"me.requestExport": {
+			Summary: "Start building a GDPR export; the link is emailed",
+			Responses: map[int]Response{
+				http.StatusAccepted:            JSON("Export job", dataExport),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.exportStatus": {
+			Summary: "State of an export job",
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Export job", dataExport),
+				http.StatusNotFound:            Error("Export not found", "export_not_found"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.activity": {
+			Summary: "Recent security events of the caller's account",
+			Params:  []Param{limit(200)},
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Events, newest first", Object(map[string]*Schema{"events": Array(activity)}, "events")),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.changeEmail": {
+			Summary: "Request an email change; it applies once the new address is verified",
+			Body: Object(map[string]*Schema{
+				"email":    String(),
+				"password": String(),
+			}, "email", "password"),
+			Responses: map[int]Response{
+				http.StatusAccepted:            Empty("Verification sent to the new address"),
+				http.StatusForbidden:           Error("Password is wrong", "wrong_password"),
+				http.StatusConflict:            Error("Email already registered", "email_taken"),
+				http.StatusTooManyRequests:     tooMany,
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.changePassword": {
+			Summary: "Change the password; other sessions are revoked",
+			Body: Object(map[string]*Schema{
+				"currentPassword": String(),
+				"newPassword":     String(),
+			}, "currentPassword", "newPassword"),
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Changed"),
+				http.StatusBadRequest:          JSON("Password rejected by the policy", weakPassword),
+				http.StatusForbidden:           Error("Current password is wrong", "wrong_password"),
+				http.StatusTooManyRequests:     tooMany,
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.sessions": {
+			Summary: "Active sessions of the caller",
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Sessions", Object(map[string]*Schema{"sessions": Array(session)}, "sessions")),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.revokeSession": {
+			Summary: "Sign out one session",
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Revoked"),
+				http.StatusNotFound:            Error("Session not found", "session_not_found"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.identities": {
+			Summary: "Linked social logins and the providers available",
+			Responses: map[int]Response{
+				http.StatusOK: JSON("Identities", Object(map[string]*Schema{
+					"identities": Array(identity),
+					"providers":  Array(String()),
+				}, "identities", "providers")),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"me.linkIdentity": {
+			Summary: "Start linking a social login to the caller",
+			Responses: map[int]Response{
+				http.StatusOK:         JSON("Provider authorization URL", authURL),
+				http.StatusNotFound:   Error("Unknown provider", "unknown_provider"),
+				http.StatusBadGateway: Error("Provider discovery failed", "provider_unavailable"),
+			},
+		},
+		"me.unlinkIdentity": {
+			Summary: "Remove a linked social login",
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Unlinked"),
+				http.StatusNotFound:            Error("Provider not linked", "not_linked"),
+				http.StatusConflict:            Error("It is the only way left to sign in", "last_login_method"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+
+		"admin.searchUsers": {
+			Summary: "Find users by email or id",
+			Params:  []Param{{Name: "q", Schema: String()}, limit(100)},
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Matching users", Object(map[string]*Schema{"users": Array(user)}, "users")),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"admin.getUser": {
+			Summary: "A user with their bank connections and session count",
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Overview", overview),
+				http.StatusNotFound:            Error("User not found", "user_not_found"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"admin.disableUser": {
+			Summary: "Disable a user and revoke their sessions",
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Disabled"),
+				http.StatusNotFound:            Error("User not found", "user_not_found"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"admin.enableUser": {
+			Summary: "Enable a disabled user",
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Enabled"),
+				http.StatusNotFound:            Error("User not found", "user_not_found"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"admin.setRole": {
+			Summary: "Change a user's role; their sessions are ended",
+			Body:    Object(map[string]*Schema{"role": Enum(model.RoleUser, model.RoleSupport, model.RoleAdmin)}, "role"),
+			Responses: map[int]Response{
+				http.StatusNoContent:           Empty("Changed"),
+				http.StatusBadRequest:          Error("Unknown role", "invalid_role"),
+				http.StatusNotFound:            Error("User not found", "user_not_found"),
+				http.StatusConflict:            Error("The caller's own or the last admin's role cannot be lowered", "own_role", "last_admin"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"admin.forceReconsent": {
+			Summary: "Mark all bank connections of a user as needing consent again",
+			Responses: map[int]Response{
+				http.StatusOK: JSON("Connections marked", Object(map[string]*Schema{
+					"connections": Integer(),
+				}, "connections")),
+				http.StatusNotFound:            Error("User not found", "user_not_found"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"admin.opInteractions": {
+			Summary: "Recorded OP requests and responses, newest first",
+			Params:  interactionParams(100),
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Interactions", Object(map[string]*Schema{"interactions": Array(interaction)}, "interactions")),
+				http.StatusBadRequest:          Error("Invalid filter", "invalid_query"),
+				http.StatusNotFound:            Error("OP recorder disabled", "recorder_disabled"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+		"admin.exportOPFixtures": {
+			Summary: "Recorded OP interactions as OP simulator fixtures, oldest first",
+			Params:  interactionParams(1000),
+			Responses: map[int]Response{
+				http.StatusOK:                  JSON("Fixture file", fixtures),
+				http.StatusBadRequest:          Error("Invalid filter", "invalid_query"),
+				http.StatusNotFound:            Error("OP recorder disabled", "recorder_disabled"),
+				http.StatusInternalServerError: failed,
+			},
+		},
+	}
+}
@@ -0,0 +1,190 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the JSON Schema subset the API uses. Objects are closed (additionalProperties
+// false) unless built with Map, so the contract check also catches undocumented fields.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"` // a type name, or [name, "null"] when nullable
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // false or *Schema
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+func String() *Schema   { return &Schema{Type: "string"} }
+func Integer() *Schema  { return &Schema{Type: "integer"} }
+func Number() *Schema   { return &Schema{Type: "number"} }
+func Boolean() *Schema  { return &Schema{Type: "boolean"} }
+func DateTime() *Schema { return &Schema{Type: "string", Format: "date-time"} }
+
+// Any accepts every JSON value
+func Any() *Schema { return &Schema{} }
+
+func Enum(values ...string) *Schema {
+	return &Schema{Type: "string", Enum: values}
+}
+
+func Array(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Object is a closed object; the listed names must be present
+func Object(props map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: props, Required: required, AdditionalProperties: false}
+}
+
+// Map is an object with arbitrary keys whose values match values
+func Map(values *Schema) *Schema {
+	return &Schema{Type: "object", AdditionalProperties: values}
+}
+
+func OneOf(schemas ...*Schema) *Schema {
+	return &Schema{OneOf: schemas}
+}
+
+// Nullable also accepts null
+func Nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return OneOf(s, &Schema{Type: "null"})
+	}
+	n := *s
+	if t, ok := s.Type.(string); ok {
+		n.Type = []string{t, "null"}
+	}
+	return &n
+}
+
+// Describe sets the description and returns s, for use inside literals
+func (s *Schema) Describe(d string) *Schema {
+	s.Description = d
+	return s
+}
+
+// Components holds the named schemas of the document (#/components/schemas)
+type Components struct {
+	Schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func NewComponents() *Components {
+	return &Components{Schemas: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+}
+
+// Define names the schema reflected from v and returns a reference to it. Types defined
+// earlier are referenced, not inlined, when they appear in fields of later ones.
+func (c *Components) Define(name string, v any) *Schema {
+	t := reflect.TypeOf(v)
+	if _, dup := c.Schemas[name]; dup {
+		panic(fmt.Sprintf("openapi: schema %s defined twice", name))
+	}
+	c.Schemas[name] = c.reflect(t)
+	c.names[t] = name
+	return Ref(name)
+}
+
+// Add names a hand-written schema and returns a reference to it
+func (c *Components) Add(name string, s *Schema) *Schema {
+	if _, dup := c.Schemas[name]; dup {
+		panic(fmt.Sprintf("openapi: schema %s defined twice", name))
+	}
+	c.Schemas[name] = s
+	return Ref(name)
+}
+
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// resolve follows a $ref to its component
+func (c *Components) resolve(s *Schema) (*Schema, error) {
+	if s.Ref == "" {
+		return s, nil
+	}
+	name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	target, ok := c.Schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %s", s.Ref)
+	}
+	return target, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// reflect describes t the way encoding/json marshals it. Fields without omitempty are always
+// present, so they are required.
+func (c *Components) reflect(t reflect.Type) *Schema {
+	if name, ok := c.names[t]; ok {
+		return Ref(name)
+	}
+	switch {
+	case t == timeType:
+		return DateTime()
+	case t.Kind() == reflect.Pointer:
+		return Nullable(c.reflect(t.Elem()))
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return String()
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Integer()
+	case reflect.Float32, reflect.Float64:
+		return Number()
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return Array(c.reflect(t.Elem()))
+	case reflect.Map:
+		return Map(c.reflect(t.Elem()))
+	case reflect.Struct:
+		s := Object(make(map[string]*Schema))
+		c.fields(t, s)
+		return s
+	default:
+		return Any()
+	}
+}
+
+func (c *Components) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			c.fields(f.Type, s)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := c.reflect(f.Type)
+		omitempty := strings.Contains(opts, "omitempty")
+		// An omitted nil pointer is never sent as null
+		if omitempty && f.Type.Kind() == reflect.Pointer {
+			fs = c.reflect(f.Type.Elem())
+		}
+		s.Properties[name] = fs
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
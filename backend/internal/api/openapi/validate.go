@@ -0,0 +1,124 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Validate checks a decoded JSON value (as from json.Unmarshal into any) against s and
+// returns every mismatch as "<path>: <problem>"
+func (c *Components) Validate(s *Schema, v any) []string {
+	var out []string
+	c.validate(s, v, "$", &out)
+	return out
+}
+
+func (c *Components) validate(s *Schema, v any, path string, out *[]string) {
+	s, err := c.resolve(s)
+	if err != nil {
+		*out = append(*out, path+": "+err.Error())
+		return
+	}
+
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, alt := range s.OneOf {
+			var problems []string
+			c.validate(alt, v, path, &problems)
+			if len(problems) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			*out = append(*out, fmt.Sprintf("%s: matches %d of the oneOf alternatives, want exactly 1", path, matched))
+		}
+		return
+	}
+
+	if s.Type == nil {
+		return // Any
+	}
+	types, ok := s.Type.([]string)
+	if !ok {
+		types = []string{s.Type.(string)}
+	}
+	got := jsonType(v)
+	if !slices.Contains(types, got) && !(got == "integer" && slices.Contains(types, "number")) {
+		*out = append(*out, fmt.Sprintf("%s: is %s, want %s", path, got, strings.Join(types, " or ")))
+		return
+	}
+
+	switch x := v.(type) {
+	case string:
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, x) {
+			*out = append(*out, fmt.Sprintf("%s: %q is not one of %s", path, x, strings.Join(s.Enum, ", ")))
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, x); err != nil {
+				*out = append(*out, fmt.Sprintf("%s: %q is not an RFC 3339 date-time", path, x))
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range x {
+				c.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), out)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, present := x[name]; !present {
+				*out = append(*out, fmt.Sprintf("%s: missing %s", path, name))
+			}
+		}
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := s.Properties[k]; ok {
+				c.validate(ps, x[k], path+"."+k, out)
+				continue
+			}
+			switch ap := s.AdditionalProperties.(type) {
+			case bool:
+				if !ap {
+					*out = append(*out, fmt.Sprintf("%s: undocumented field %s", path, k))
+				}
+			case *Schema:
+				c.validate(ap, x[k], path+"."+k, out)
+			}
+		}
+	}
+}
+
+func jsonType(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if x == float64(int64(x)) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,98 @@
+// Package request decodes and validates JSON request bodies the same way for every handler:
+// a size limit, application/json only, no unknown fields, a single JSON value, and the
+// `validate` tag rules of the target struct. Problems are answered in one format:
+//
+//	{"error": "invalid_body", "reason": "malformed_json"}
+//	{"error": "invalid_field", "field": "email", "reason": "invalid_email", "fields": [...]}
+//
+// where field and reason repeat the first entry of fields for clients reading only those.
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+)
+
+// MaxBytes bounds every JSON body; none of ours comes close
+const MaxBytes = 64 << 10
+
+// Decode reads the JSON body into dst and validates it. On failure it has written the error
+// response and returns false.
+func Decode(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decode(w, r, dst, false)
+}
+
+// DecodeOptional is Decode for routes where the body may be left out; dst keeps its zero
+// value then and is not validated
+func DecodeOptional(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decode(w, r, dst, true)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, dst any, optional bool) bool {
+	if optional && r.ContentLength == 0 && r.Header.Get("Content-Type") == "" {
+		return true
+	}
+	// Also keeps cross-site HTML forms out, as they cannot send application/json
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		httpx.WriteProblem(w, httpx.Problem{Error: "unsupported_media_type", Reason: "application_json_required"}, http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		if errors.Is(err, io.EOF) && optional {
+			return true
+		}
+		writeDecodeError(w, err)
+		return false
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeDecodeError(w, err)
+			return false
+		}
+		httpx.WriteProblem(w, httpx.Problem{Error: "invalid_body", Reason: "trailing_data"}, http.StatusBadRequest)
+		return false
+	}
+
+	problems, err := Validate(dst)
+	if err != nil {
+		log.Println(err)
+		httpx.WriteError(w, "internal_error", "could not validate request", http.StatusInternalServerError)
+		return false
+	}
+	if len(problems) > 0 {
+		httpx.WriteFieldErrors(w, problems)
+		return false
+	}
+	return true
+}
+
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		httpx.WriteProblem(w, httpx.Problem{Error: "body_too_large"}, http.StatusRequestEntityTooLarge)
+	case errors.Is(err, io.EOF):
+		httpx.WriteProblem(w, httpx.Problem{Error: "invalid_body", Reason: "empty"}, http.StatusBadRequest)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		httpx.WriteFieldErrors(w, []httpx.FieldProblem{{Field: typeErr.Field, Reason: "invalid_type"}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for this one
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		httpx.WriteFieldErrors(w, []httpx.FieldProblem{{Field: field, Reason: "unknown_field"}})
+	default:
+		httpx.WriteProblem(w, httpx.Problem{Error: "invalid_body", Reason: "malformed_json"}, http.StatusBadRequest)
+	}
+}
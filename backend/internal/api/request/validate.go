@@ -0,0 +1,294 @@
+package request
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+)
+
+// Validate checks the `validate` tags of a struct (or pointer to one) and returns a problem
+// per invalid field, named by its json name. Rules are comma separated:
+//
+//	required     not the zero value (a non-nil pointer)
+//	email        a bare address, user@example.com
+//	uuid         a UUID in its 36 character form
+//	min=N, max=N length in characters of a string, length of a slice, or a number's value
+//	oneof=a b c  one of the space separated strings
+//
+// Rules other than required skip empty values, so optional fields only need checking when sent.
+// Nested structs are validated with their field names prefixed by the parent's. The tags of a
+// type are parsed once; an error means they are broken (see Register).
+func Validate(v any) ([]httpx.FieldProblem, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	rules, err := rulesFor(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	var out []httpx.FieldProblem
+	rules.check(rv, "", &out)
+	return out, nil
+}
+
+// Register parses the `validate` tags of the request types a handler decodes into and panics
+// if one is broken, so a bad rule stops the server at startup instead of failing a request.
+// Handlers call it from their constructor; Decode still parses unregistered types on first use.
+func Register(types ...any) {
+	for _, v := range types {
+		t := reflect.TypeOf(v)
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if _, err := rulesFor(t); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// structRules are the parsed tags of one struct type
+type structRules struct {
+	fields []fieldRules
+}
+
+type fieldRules struct {
+	index    int
+	name     string // json name
+	required bool
+	checks   []func(reflect.Value) string // reason code on failure, "" when it passes
+	nested   *structRules                 // struct fields, or pointers to them
+}
+
+var parsed sync.Map // reflect.Type -> *structRules
+
+func rulesFor(t reflect.Type) (*structRules, error) {
+	if r, ok := parsed.Load(t); ok {
+		return r.(*structRules), nil
+	}
+	r, err := parseStruct(t)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Store(t, r)
+	return r, nil
+}
+
+func parseStruct(t reflect.Type) (*structRules, error) {
+	r := &structRules{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fr := fieldRules{index: i, name: name}
+		elem := f.Type
+		for elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if tag := f.Tag.Get("validate"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				if rule == "required" {
+					fr.required = true
+					continue
+				}
+				check, err := parseRule(rule, elem)
+				if err != nil {
+					return nil, fmt.Errorf("request: %s.%s: %w", t, f.Name, err)
+				}
+				fr.checks = append(fr.checks, check)
+			}
+		}
+		if elem.Kind() == reflect.Struct && elem != t {
+			nested, err := parseStruct(elem)
+			if err != nil {
+				return nil, err
+			}
+			fr.nested = nested
+		}
+		r.fields = append(r.fields, fr)
+	}
+	return r, nil
+}
+
+// parseRule turns one rule into its check of a value of kind t
+func parseRule(rule string, t reflect.Type) (func(reflect.Value) string, error) {
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "email", "uuid", "oneof":
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("rule %q on %s", rule, t)
+		}
+	}
+	switch name {
+	case "email":
+		return func(v reflect.Value) string {
+			if !isEmail(v.String()) {
+				return "invalid_email"
+			}
+			return ""
+		}, nil
+	case "uuid":
+		return func(v reflect.Value) string {
+			if !isUUID(v.String()) {
+				return "invalid_uuid"
+			}
+			return ""
+		}, nil
+	case "oneof":
+		allowed := strings.Fields(arg)
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("rule %q lists no values", rule)
+		}
+		return func(v reflect.Value) string {
+			if !slices.Contains(allowed, v.String()) {
+				return "not_allowed"
+			}
+			return ""
+		}, nil
+	case "min", "max":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s rule %q", name, rule)
+		}
+		number, ok := measurable(t.Kind())
+		if !ok {
+			return nil, fmt.Errorf("rule %q on %s", rule, t)
+		}
+		reason := "too_short"
+		switch {
+		case name == "min" && number:
+			reason = "too_small"
+		case name == "max" && number:
+			reason = "too_large"
+		case name == "max":
+			reason = "too_long"
+		}
+		return func(v reflect.Value) string {
+			size := measure(v)
+			if name == "min" && size < n || name == "max" && size > n {
+				return reason
+			}
+			return ""
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown validation rule %q", rule)
+	}
+}
+
+func (r *structRules) check(rv reflect.Value, prefix string, out *[]httpx.FieldProblem) {
+	for _, f := range r.fields {
+		fv := rv.Field(f.index)
+		if reason := f.checkValue(fv); reason != "" {
+			*out = append(*out, httpx.FieldProblem{Field: prefix + f.name, Reason: reason})
+			continue
+		}
+		if f.nested == nil {
+			continue
+		}
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct {
+			f.nested.check(fv, prefix+f.name+".", out)
+		}
+	}
+}
+
+// checkValue returns the reason code of the first rule v breaks, "" when it passes
+func (f *fieldRules) checkValue(v reflect.Value) string {
+	if f.required && v.IsZero() {
+		return "required"
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.IsZero() {
+		return ""
+	}
+	for _, check := range f.checks {
+		if reason := check(v); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// measurable reports whether min and max apply to kind, and whether they compare a number
+func measurable(kind reflect.Kind) (number, ok bool) {
+	switch kind {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return false, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// measure is the size min and max compare, for a kind measurable accepts
+func measure(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func isEmail(s string) bool {
+	s = strings.TrimSpace(s)
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s && a.Name == ""
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
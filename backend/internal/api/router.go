@@ -0,0 +1,228 @@
+// Package api holds the HTTP router: every endpoint is registered in a route group that
+// applies its middleware stack, and is described by a Route that logging, metrics and the
+// OpenAPI document read.
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/metrics"
+)
+
+// Route is the metadata of one endpoint
+type Route struct {
+	Method string
+	Path   string // ServeMux wildcard pattern, e.g. /admin/users/{id}
+	Name   string // stable id such as "auth.login": metric label and OpenAPI operationId
+	Group  string // public | authenticated | staff | admin
+	// Quiet routes (probes, scrapes) are counted but not access logged
+	Quiet bool
+	// Timeout bounds the request context, DefaultTimeout when zero
+	Timeout time.Duration
+	// Conditional read endpoints get an ETag and answer If-None-Match with 304
+	Conditional bool
+}
+
+// DefaultTimeout is the request context deadline of routes without their own Timeout
+const DefaultTimeout = 5 * time.Second
+
+// Pattern is the ServeMux pattern, also what r.Pattern holds for a matched request
+func (rt *Route) Pattern() string {
+	return rt.Method + " " + rt.Path
+}
+
+// Router is a ServeMux with a route registry. ServeMux itself answers 404, and 405 with an
+// Allow header listing the registered methods of the path.
+type Router struct {
+	mux    *http.ServeMux
+	routes map[string]*Route // by pattern
+
+	mu    sync.Mutex
+	stats map[statKey]*routeStats
+}
+
+type statKey struct {
+	name, method, code string
+}
+
+type routeStats struct {
+	count    float64
+	duration float64 // seconds
+}
+
+func NewRouter() *Router {
+	r := &Router{
+		mux:    http.NewServeMux(),
+		routes: make(map[string]*Route),
+		stats:  make(map[statKey]*routeStats),
+	}
+	r.registerMetrics()
+	return r
+}
+
+// Group starts a route group; mw wraps every route of the group, the first one outermost
+func (r *Router) Group(name string, mw ...func(http.Handler) http.Handler) *Group {
+	return &Group{router: r, name: name, mw: mw}
+}
+
+// Routes lists the registered routes sorted by path, then method
+func (r *Router) Routes() []Route {
+	out := make([]Route, 0, len(r.routes))
+	for _, rt := range r.routes {
+		out = append(out, *rt)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+// Lookup returns the route a handled request matched, once ServeHTTP has routed it
+func (r *Router) Lookup(req *http.Request) (*Route, bool) {
+	rt, ok := r.routes[req.Pattern]
+	return rt, ok
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	r.mux.ServeHTTP(sw, req)
+	elapsed := time.Since(start)
+
+	// ServeMux sets req.Pattern while routing. Unmatched requests (404, 405) have none and
+	// may carry any method, so neither is used as a label for them.
+	name, method, quiet := "unmatched", "other", false
+	if rt, ok := r.Lookup(req); ok {
+		name, method, quiet = rt.Name, req.Method, rt.Quiet
+	}
+	r.observe(statKey{name: name, method: method, code: strconv.Itoa(sw.status/100) + "xx"}, elapsed)
+	if !quiet {
+		log.Printf("http %s %s %s %d %s", name, req.Method, req.URL.Path, sw.status, elapsed.Round(time.Millisecond))
+	}
+}
+
+func (r *Router) add(rt *Route, h http.Handler) {
+	p := rt.Pattern()
+	if _, dup := r.routes[p]; dup {
+		panic(fmt.Sprintf("api: route %s registered twice", p))
+	}
+	r.routes[p] = rt
+	r.mux.Handle(p, h)
+}
+
+func (r *Router) observe(k statKey, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats[k]
+	if s == nil {
+		s = &routeStats{}
+		r.stats[k] = s
+	}
+	s.count++
+	s.duration += d.Seconds()
+}
+
+func (r *Router) registerMetrics() {
+	collect := func(value func(*routeStats) float64) metrics.Collector {
+		return func() []metrics.Sample {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			out := make([]metrics.Sample, 0, len(r.stats))
+			for k, s := range r.stats {
+				out = append(out, metrics.Sample{
+					Labels: map[string]string{"route": k.name, "method": k.method, "code": k.code},
+					Value:  value(s),
+				})
+			}
+			return out
+		}
+	}
+	metrics.Counter("opl_http_requests_total", "HTTP requests per route, method and status class.",
+		collect(func(s *routeStats) float64 { return s.count }))
+	metrics.Counter("opl_http_request_duration_seconds_total", "Time spent serving HTTP requests per route, method and status class.",
+		collect(func(s *routeStats) float64 { return s.duration }))
+}
+
+// Group registers routes sharing a middleware stack
+type Group struct {
+	router *Router
+	name   string
+	mw     []func(http.Handler) http.Handler
+}
+
+// Handle registers h for method and path and returns its route for further metadata. The
+// route's Timeout covers the group middleware too; Conditional wraps h alone.
+func (g *Group) Handle(method, path, name string, h http.HandlerFunc) *Route {
+	rt := &Route{Method: method, Path: path, Name: name, Group: g.name}
+	conditional := httpx.Conditional(h)
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Metadata is set after registration, so it is read per request
+		if rt.Conditional {
+			conditional.ServeHTTP(w, r)
+			return
+		}
+		h(w, r)
+	})
+	for i := len(g.mw) - 1; i >= 0; i-- {
+		handler = g.mw[i](handler)
+	}
+	g.router.add(rt, withTimeout(rt, handler))
+	return rt
+}
+
+func withTimeout(rt *Route, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := rt.Timeout
+		if d == 0 {
+			d = DefaultTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (g *Group) GET(path, name string, h http.HandlerFunc) *Route {
+	return g.Handle(http.MethodGet, path, name, h)
+}
+
+func (g *Group) POST(path, name string, h http.HandlerFunc) *Route {
+	return g.Handle(http.MethodPost, path, name, h)
+}
+
+func (g *Group) PUT(path, name string, h http.HandlerFunc) *Route {
+	return g.Handle(http.MethodPut, path, name, h)
+}
+
+func (g *Group) PATCH(path, name string, h http.HandlerFunc) *Route {
+	return g.Handle(http.MethodPatch, path, name, h)
+}
+
+func (g *Group) DELETE(path, name string, h http.HandlerFunc) *Route {
+	return g.Handle(http.MethodDelete, path, name, h)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
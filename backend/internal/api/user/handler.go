@@ -1,19 +1,151 @@
 package user
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/request"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/password"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
 )
 
-type Handler struct{}
+type Handler struct {
+	auth    *service.AuthService
+	users   *service.UserService
+	privacy *service.PrivacyService
+}
 
-func NewHandler() *Handler {
-	return &Handler{}
+func NewHandler(auth *service.AuthService, users *service.UserService, privacy *service.PrivacyService) *Handler {
+	request.Register(model.ProfileUpdate{}, changeEmailReq{}, changePasswordReq{}, deleteAccountReq{})
+	return &Handler{auth: auth, users: users, privacy: privacy}
 }
 
 func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.UserIDFromContext(r.Context())
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("You are user: " + userID))
+
+	ctx := r.Context()
+
+	u, err := h.users.Profile(ctx, userID)
+	if err != nil {
+		if service.IsNoRows(err) {
+			httpx.WriteError(w, "user_not_found", "user not found", http.StatusNotFound)
+			return
+		}
+		httpx.WriteError(w, "internal_error", "could not load profile", http.StatusInternalServerError)
+		return
+	}
+	httpx.WriteJSON(w, u, http.StatusOK)
+}
+
+func (h *Handler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	var upd model.ProfileUpdate
+	if !request.Decode(w, r, &upd) {
+		return
+	}
+
+	ctx := r.Context()
+
+	u, err := h.users.UpdateProfile(ctx, userID, upd)
+	if err != nil {
+		if writeFieldError(w, err) {
+			return
+		}
+		httpx.WriteError(w, "internal_error", "could not update profile", http.StatusInternalServerError)
+		return
+	}
+	httpx.WriteJSON(w, u, http.StatusOK)
+}
+
+type changeEmailReq struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ChangeEmail sends a verification to the new address; the email changes once it is confirmed
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	var req changeEmailReq
+	if !request.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	err := h.users.RequestEmailChange(ctx, userID, req.Email, req.Password)
+	if err != nil {
+		switch {
+		case writeFieldError(w, err):
+		case httpx.WriteLimited(w, err):
+		case errors.Is(err, service.ErrInvalidCredentials):
+			httpx.WriteError(w, "wrong_password", "password is wrong", http.StatusForbidden)
+		case errors.Is(err, service.ErrEmailTaken):
+			httpx.WriteError(w, "email_taken", err.Error(), http.StatusConflict)
+		default:
+			httpx.WriteError(w, "internal_error", "could not request email change", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		httpx.WriteError(w, "unauthorized", "missing user context", http.StatusUnauthorized)
+		return
+	}
+
+	var req changePasswordReq
+	if !request.Decode(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	sessionID, _ := middleware.SessionIDFromContext(r.Context())
+	err := h.auth.ChangePassword(ctx, userID, sessionID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		var pe *password.PolicyError
+		switch {
+		case errors.As(err, &pe):
+			httpx.WriteJSON(w, map[string]any{"error": "weak_password", "reasons": pe.Reasons}, http.StatusBadRequest)
+		case httpx.WriteLimited(w, err):
+		case errors.Is(err, service.ErrInvalidCredentials):
+			httpx.WriteError(w, "wrong_password", "current password is wrong", http.StatusForbidden)
+		default:
+			httpx.WriteError(w, "internal_error", "could not change password", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) Activity(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	ctx := r.Context()
+
+	events, err := h.users.Activity(ctx, userID, limit)
+	if err != nil {
+		httpx.WriteError(w, "internal_error", "could not load activity", http.StatusInternalServerError)
+		return
+	}
+	httpx.WriteJSON(w, map[string]any{"events": events}, http.StatusOK)
 }
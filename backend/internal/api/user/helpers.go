@@ -0,0 +1,18 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+)
+
+func writeFieldError(w http.ResponseWriter, err error) bool {
+	var fe *service.FieldError
+	if !errors.As(err, &fe) {
+		return false
+	}
+	httpx.WriteFieldErrors(w, []httpx.FieldProblem{{Field: fe.Field, Reason: fe.Reason}})
+	return true
+}
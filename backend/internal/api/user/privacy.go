@@ -0,0 +1,109 @@
+package user
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/request"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+)
+
+// RequestExport starts building the GDPR archive; the download link is sent by email
+func (h *Handler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	ctx := r.Context()
+
+	e, err := h.privacy.RequestExport(ctx, userID)
+	if err != nil {
+		httpx.WriteError(w, "internal_error", "could not start export", http.StatusInternalServerError)
+		return
+	}
+	httpx.WriteJSON(w, e, http.StatusAccepted)
+}
+
+func (h *Handler) ExportStatus(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	ctx := r.Context()
+
+	e, err := h.privacy.ExportStatus(ctx, userID, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrExportNotFound) {
+			httpx.WriteError(w, "export_not_found", err.Error(), http.StatusNotFound)
+			return
+		}
+		httpx.WriteError(w, "internal_error", "could not load export", http.StatusInternalServerError)
+		return
+	}
+	httpx.WriteJSON(w, e, http.StatusOK)
+}
+
+// DownloadExport is public: the unguessable, expiring token in the link is the credential
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	path, err := h.privacy.ExportFile(ctx, r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, service.ErrExportNotFound) {
+			httpx.WriteError(w, "export_not_found", err.Error(), http.StatusNotFound)
+			return
+		}
+		httpx.WriteError(w, "internal_error", "could not load export", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		httpx.WriteError(w, "export_gone", "export file missing", http.StatusGone)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="onepointledger-export.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, f); err != nil {
+		log.Println("export download:", err)
+	}
+}
+
+type deleteAccountReq struct {
+	Password string `json:"password"`
+}
+
+// DeleteMe revokes all bank consents and erases the account
+func (h *Handler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	// Accounts with only social logins have no password to send; they sign in again instead
+	var req deleteAccountReq
+	if !request.DecodeOptional(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	sessionID, _ := middleware.SessionIDFromContext(ctx)
+	if err := h.privacy.DeleteAccount(ctx, userID, sessionID, req.Password); err != nil {
+		switch {
+		case httpx.WriteLimited(w, err):
+			return
+		case errors.Is(err, service.ErrInvalidCredentials):
+			httpx.WriteError(w, "wrong_password", "password is wrong", http.StatusForbidden)
+			return
+		case errors.Is(err, service.ErrSignInRequired):
+			httpx.WriteError(w, "sign_in_required", "sign in again with your identity provider, then retry within 10 minutes", http.StatusForbidden)
+			return
+		}
+		log.Println("delete account:", err)
+		httpx.WriteError(w, "consent_revocation_failed", "could not delete account, bank consents may still be active; try again", http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,43 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/middleware"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/service"
+)
+
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+	sessionID, _ := middleware.SessionIDFromContext(r.Context())
+
+	ctx := r.Context()
+
+	sessions, err := h.auth.ListSessions(ctx, userID, sessionID)
+	if err != nil {
+		httpx.WriteError(w, "internal_error", "could not list sessions", http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []model.Session{}
+	}
+	httpx.WriteJSON(w, map[string]any{"sessions": sessions}, http.StatusOK)
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromContext(r.Context())
+
+	ctx := r.Context()
+
+	if err := h.auth.RevokeSession(ctx, userID, r.PathValue("id")); err != nil {
+		if service.IsNoRows(err) {
+			httpx.WriteError(w, "session_not_found", "session not found", http.StatusNotFound)
+			return
+		}
+		httpx.WriteError(w, "internal_error", "could not revoke session", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
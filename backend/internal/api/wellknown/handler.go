@@ -0,0 +1,79 @@
+package wellknown
+
+import (
+	"crypto"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/api/httpx"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/certs"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+)
+
+// Key is one published QSEAL key: the active signing key of an OP environment, or a
+// certificate published ahead of / after a rotation
+type Key struct {
+	Kid  string
+	Alg  string
+	Cert *certs.Cert
+}
+
+// Handler serves /.well-known/tpp-jwks.json, the JWKS URI registered in our software statement
+type Handler struct {
+	keys []Key
+}
+
+// NewHandler refuses a kid listed with different keys or algs, e.g. the same qseal_kid in two
+// OP environments: only one could be published and the bank would reject the other's signatures.
+// Keys cannot change under their kid later, certs refuses such a reload.
+func NewHandler(keys []Key) (*Handler, error) {
+	first := make(map[string]Key)
+	for _, k := range keys {
+		prev, ok := first[k.Kid]
+		if !ok {
+			first[k.Kid] = k
+			continue
+		}
+		if !certs.SameKey(publicKey(prev), publicKey(k)) {
+			return nil, fmt.Errorf("jwks: kid %s is used for different keys (%s, %s)", k.Kid, prev.Cert.Name, k.Cert.Name)
+		}
+		if prev.Alg != k.Alg {
+			return nil, fmt.Errorf("jwks: kid %s is used with %s and %s", k.Kid, prev.Alg, k.Alg)
+		}
+	}
+	return &Handler{keys: keys}, nil
+}
+
+// publicKey is what is published for k. A file key without certificate (no
+// OP_QSEAL_CERT_PATH) is published bare.
+func publicKey(k Key) crypto.PublicKey {
+	if chain := k.Cert.Chain(); len(chain) > 0 {
+		return chain[0].PublicKey
+	}
+	return k.Cert.Public()
+}
+
+// TPPJWKS is built per request so reloaded certificates show up immediately
+func (h *Handler) TPPJWKS(w http.ResponseWriter, r *http.Request) {
+	seen := make(map[string]bool)
+	out := []opjwt.JWK{}
+	for _, k := range h.keys {
+		// Environments may share a key; NewHandler made sure it is the same one
+		if seen[k.Kid] {
+			continue
+		}
+		seen[k.Kid] = true
+
+		jwk, err := opjwt.PublicJWK(k.Kid, k.Alg, publicKey(k), k.Cert.Chain())
+		if err != nil {
+			log.Printf("jwks: key %s: %v", k.Kid, err)
+			continue
+		}
+		out = append(out, jwk)
+	}
+
+	// Verifiers cache this; short enough that a rotation propagates quickly
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	httpx.WriteJSON(w, map[string]any{"keys": out}, http.StatusOK)
+}
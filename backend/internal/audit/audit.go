@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event is one security or compliance relevant action. It holds no IP address: the log
+// cannot be edited and outlives account erasure, while sign-in events keep IPs until then.
+type Event struct {
+	ActorID      string         // user performing the action, empty for system
+	Action       string         // e.g. "admin.user.disable"
+	TargetUserID string         // user affected, if any
+	Details      map[string]any // never put emails or other PII here, the log cannot be edited
+}
+
+// Entry is a stored event with its position in the hash chain
+type Entry struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ActorID      string    `json:"actorId"`
+	Action       string    `json:"action"`
+	TargetUserID string    `json:"targetUserId"`
+	IP           string    `json:"ip"`      // only set on rows written before events dropped it
+	Details      string    `json:"details"` // raw JSON exactly as hashed
+	PrevHash     string    `json:"prevHash"`
+	Hash         string    `json:"hash"`
+}
+
+// Arbitrary constant key for pg_advisory_xact_lock: serializes appends to the chain
+const chainLockKey = 7261001
+
+// Recorder appends events to audit_log. Each row stores the hash of the previous row,
+// so editing or deleting any row breaks every hash after it (see Verify).
+type Recorder struct {
+	db *sql.DB
+}
+
+func NewRecorder(db *sql.DB) *Recorder {
+	return &Recorder{db: db}
+}
+
+func (r *Recorder) Record(ctx context.Context, e Event) error {
+	details := []byte("{}")
+	if len(e.Details) > 0 {
+		b, err := json.Marshal(e.Details)
+		if err != nil {
+			return fmt.Errorf("marshal audit details: %w", err)
+		}
+		details = b
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1);`, chainLockKey); err != nil {
+		return fmt.Errorf("lock audit chain: %w", err)
+	}
+
+	var prevHash string
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1;`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read chain head: %w", err)
+	}
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('audit_log', 'id'));`).Scan(&id); err != nil {
+		return fmt.Errorf("next audit id: %w", err)
+	}
+
+	entry := Entry{
+		ID:           id,
+		CreatedAt:    time.Now().UTC().Truncate(time.Microsecond), // Postgres precision
+		ActorID:      e.ActorID,
+		Action:       e.Action,
+		TargetUserID: e.TargetUserID,
+		Details:      string(details),
+		PrevHash:     prevHash,
+	}
+	entry.Hash = entry.computeHash()
+
+	const q = `
+		INSERT INTO audit_log (id, created_at, actor_id, action, target_user_id, ip, details, prev_hash, hash)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, NULLIF($5, '')::uuid, $6, $7, $8, $9);
+	`
+	_, err = tx.ExecContext(ctx, q, entry.ID, entry.CreatedAt, entry.ActorID, entry.Action,
+		entry.TargetUserID, entry.IP, entry.Details, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return fmt.Errorf("insert audit event: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListForUser returns the newest events that affected or were performed by userID
+func (r *Recorder) ListForUser(ctx context.Context, userID string, limit int) ([]Entry, error) {
+	const q = `
+		SELECT ` + entryColumns + `
+		FROM audit_log
+		WHERE target_user_id = $1 OR actor_id = $1
+		ORDER BY id DESC
+		LIMIT $2;
+	`
+	rows, err := r.db.QueryContext(ctx, q, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+const entryColumns = `id, created_at, COALESCE(actor_id::text, ''), action, COALESCE(target_user_id::text, ''), ip, details::text, prev_hash, hash`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEntry(row rowScanner) (Entry, error) {
+	var e Entry
+	err := row.Scan(&e.ID, &e.CreatedAt, &e.ActorID, &e.Action, &e.TargetUserID, &e.IP, &e.Details, &e.PrevHash, &e.Hash)
+	e.CreatedAt = e.CreatedAt.UTC()
+	return e, err
+}
+
+// computeHash covers every column, chained to the previous row
+func (e Entry) computeHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%s\n%s\n%s\n%s\n%s\n%s",
+		e.PrevHash, e.ID, e.CreatedAt.Format(time.RFC3339Nano),
+		e.ActorID, e.Action, e.TargetUserID, e.IP, e.Details)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/db"
+)
+
+const (
+	// genesisAction marks where the chain starts. The schema script writes it once, with the
+	// number of rows that predate the chain and so have no hashes.
+	genesisAction = "audit.chain.genesis"
+	// genesisSchemaVersion is the first schema_version whose script writes the genesis row
+	genesisSchemaVersion = 5
+)
+
+// VerifyResult summarizes a full chain check
+type VerifyResult struct {
+	Legacy   int64 // rows before the genesis row; only their number can be checked
+	Entries  int64
+	Head     string
+	BrokenAt int64  // id of the first bad row, 0 when the chain is intact or the bad rows are gone
+	Problem  string // empty when the chain is intact
+}
+
+// Verify walks the log after the genesis row in id order and recomputes every hash. Without a
+// genesis row it walks the whole log, unless the schema is new enough to have written one: then
+// the log was truncated.
+//
+// Rows deleted from the end leave a shorter but valid chain. knownHead, a head recorded outside
+// the database by an earlier run, catches that: it must still be in the chain. Empty skips it.
+func Verify(ctx context.Context, sqlDB *sql.DB, knownHead string) (VerifyResult, error) {
+	var res VerifyResult
+	var genesisID int64
+	var details []byte
+	err := sqlDB.QueryRowContext(ctx, `SELECT id, details::text FROM audit_log WHERE action = $1;`, genesisAction).
+		Scan(&genesisID, &details)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		v, err := db.CurrentSchemaVersion(ctx, sqlDB)
+		if err != nil {
+			return res, fmt.Errorf("schema version: %w", err)
+		}
+		if v >= genesisSchemaVersion {
+			res.Problem = "no genesis row although the schema wrote one (log truncated)"
+			return res, nil
+		}
+	case err != nil:
+		return res, err
+	default:
+		var genesis struct {
+			LegacyRows int64 `json:"legacyRows"`
+		}
+		if err := json.Unmarshal(details, &genesis); err != nil {
+			return res, fmt.Errorf("genesis row: %w", err)
+		}
+		if err := sqlDB.QueryRowContext(ctx, `SELECT count(*) FROM audit_log WHERE id < $1;`, genesisID).Scan(&res.Legacy); err != nil {
+			return res, err
+		}
+		if res.Legacy != genesis.LegacyRows {
+			res.BrokenAt, res.Problem = genesisID, fmt.Sprintf("%d rows before the genesis row, it recorded %d (row deleted)", res.Legacy, genesis.LegacyRows)
+			return res, nil
+		}
+	}
+
+	rows, err := sqlDB.QueryContext(ctx, `SELECT `+entryColumns+` FROM audit_log WHERE id > $1 ORDER BY id;`, genesisID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	prev := ""
+	headFound := knownHead == ""
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return res, err
+		}
+		res.Entries++
+
+		switch {
+		case e.PrevHash != prev:
+			res.BrokenAt, res.Problem = e.ID, "prev_hash does not match previous row (row deleted or reordered)"
+		case e.computeHash() != e.Hash:
+			res.BrokenAt, res.Problem = e.ID, "hash does not match row content (row modified)"
+		}
+		if res.BrokenAt != 0 {
+			return res, nil
+		}
+		prev = e.Hash
+		headFound = headFound || e.Hash == knownHead
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+	res.Head = prev
+	if !headFound {
+		res.Problem = "recorded head " + knownHead + " is no longer in the chain (rows deleted from the end)"
+	}
+	return res, nil
+}
+
+func (r VerifyResult) String() string {
+	switch {
+	case r.BrokenAt != 0:
+		return fmt.Sprintf("audit chain BROKEN at id %d after %d entries: %s", r.BrokenAt, r.Entries, r.Problem)
+	case r.Problem != "":
+		return fmt.Sprintf("audit chain BROKEN after %d entries: %s", r.Entries, r.Problem)
+	}
+	return fmt.Sprintf("audit chain OK: %d entries, head %s (%d unchained rows before it)", r.Entries, r.Head, r.Legacy)
+}
@@ -0,0 +1,112 @@
+package certs
+
+import (
+	"log"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/metrics"
+)
+
+// Warnings get louder and more frequent closer to expiry
+var warnLevels = []struct {
+	within time.Duration
+	repeat time.Duration
+	prefix string
+}{
+	{30 * 24 * time.Hour, 7 * 24 * time.Hour, "NOTICE"},
+	{14 * 24 * time.Hour, 24 * time.Hour, "WARNING"},
+	{7 * 24 * time.Hour, 6 * time.Hour, "WARNING"},
+	{24 * time.Hour, time.Hour, "ERROR"},
+	{0, 10 * time.Minute, "ERROR"}, // expired
+}
+
+func (m *Manager) checkExpiry(now time.Time) {
+	for _, c := range m.Certs() {
+		c.checkExpiry(now)
+	}
+}
+
+func (c *Cert) checkExpiry(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info == nil {
+		return
+	}
+
+	left := c.info.NotAfter.Sub(now)
+	level := 0
+	for i, l := range warnLevels {
+		if left <= l.within {
+			level = i + 1
+		}
+	}
+	if level == 0 {
+		return
+	}
+
+	l := warnLevels[level-1]
+	if level == c.warnLevel && now.Sub(c.warnedAt) < l.repeat {
+		return
+	}
+	c.warnLevel = level
+	c.warnedAt = now
+
+	if left <= 0 {
+		log.Printf("%s: %s certificate of %s EXPIRED at %s", l.prefix, c.Kind, c.Name, c.info.NotAfter.UTC().Format(time.RFC3339))
+		return
+	}
+	log.Printf("%s: %s certificate of %s expires in %s (%s)", l.prefix, c.Kind, c.Name,
+		left.Round(time.Minute), c.info.NotAfter.UTC().Format(time.RFC3339))
+}
+
+func (m *Manager) registerMetrics() {
+	metrics.Gauge("opl_certificate_expiry_timestamp_seconds", "NotAfter of QWAC/QSEAL certificates.", func() []metrics.Sample {
+		var out []metrics.Sample
+		for _, c := range m.Certs() {
+			if info, _ := c.Info(); info != nil {
+				out = append(out, metrics.Sample{
+					Labels: map[string]string{"environment": c.Name, "kind": c.Kind},
+					Value:  float64(info.NotAfter.Unix()),
+				})
+			}
+		}
+		return out
+	})
+	metrics.Gauge("opl_certificate_psd2_role", "PSD2 roles granted by each certificate (1 per role).", func() []metrics.Sample {
+		var out []metrics.Sample
+		for _, c := range m.Certs() {
+			info, _ := c.Info()
+			if info == nil {
+				continue
+			}
+			for _, r := range info.PSD2Roles {
+				out = append(out, metrics.Sample{
+					Labels: map[string]string{"environment": c.Name, "kind": c.Kind, "role": r},
+					Value:  1,
+				})
+			}
+		}
+		return out
+	})
+	metrics.Gauge("opl_certificate_reload_error", "1 when the last reload of the files failed.", func() []metrics.Sample {
+		var out []metrics.Sample
+		for _, c := range m.Certs() {
+			v := 0.0
+			if _, err := c.Info(); err != nil {
+				v = 1
+			}
+			out = append(out, metrics.Sample{Labels: map[string]string{"environment": c.Name, "kind": c.Kind}, Value: v})
+		}
+		return out
+	})
+	metrics.Counter("opl_certificate_loads_total", "Successful loads of certificate/key files.", func() []metrics.Sample {
+		var out []metrics.Sample
+		for _, c := range m.Certs() {
+			c.mu.RLock()
+			n := c.reloads
+			c.mu.RUnlock()
+			out = append(out, metrics.Sample{Labels: map[string]string{"environment": c.Name, "kind": c.Kind}, Value: float64(n)})
+		}
+		return out
+	})
+}
@@ -0,0 +1,328 @@
+package certs
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+)
+
+const (
+	KindQWAC  = "qwac"
+	KindQSEAL = "qseal"
+)
+
+// Cert is one managed certificate and key. Callers always get the latest loaded version.
+type Cert struct {
+	Name     string // environment name
+	Kind     string
+	certPath string
+	keyPath  string
+
+	mu        sync.RWMutex
+	tlsCert   *tls.Certificate    // QWAC
+	sealKey   crypto.Signer       // QSEAL file key, nil when the key lives in an HSM or remote signer
+	chain     []*x509.Certificate // leaf first
+	info      *Info               // nil for a QSEAL key without certificate
+	modTimes  [2]time.Time
+	lastErr   error
+	reloads   int
+	onReload  []func()
+	warnLevel int
+	warnedAt  time.Time
+}
+
+// GetClientCertificate plugs into tls.Config so new mTLS connections use the current QWAC
+func (c *Cert) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tlsCert, nil
+}
+
+// Public and Sign make a file based QSEAL a crypto.Signer that always uses the current key
+func (c *Cert) Public() crypto.PublicKey {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.sealKey == nil {
+		return nil
+	}
+	return c.sealKey.Public()
+}
+
+func (c *Cert) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	c.mu.RLock()
+	key := c.sealKey
+	c.mu.RUnlock()
+	if key == nil {
+		return nil, fmt.Errorf("%s %s: no key file configured", c.Kind, c.Name)
+	}
+	return key.Sign(rand, digest, opts)
+}
+
+// Certificate is the current leaf certificate, nil for a key without certificate
+func (c *Cert) Certificate() *x509.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.chain) == 0 {
+		return nil
+	}
+	return c.chain[0]
+}
+
+// Chain is the certificate followed by any intermediates from the same file
+func (c *Cert) Chain() []*x509.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.chain
+}
+
+// Info returns the parsed certificate, if any, and the last reload error
+func (c *Cert) Info() (*Info, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.info, c.lastErr
+}
+
+// OnReload runs f after the files changed and were loaded, e.g. to drop idle connections
+func (c *Cert) OnReload(f func()) {
+	c.mu.Lock()
+	c.onReload = append(c.onReload, f)
+	c.mu.Unlock()
+}
+
+// Manager loads the QWAC and QSEAL material of every OP environment, reloads it when the
+// files change and warns, louder and more often, as expiry approaches.
+type Manager struct {
+	mu    sync.Mutex
+	certs []*Cert
+}
+
+func NewManager() *Manager {
+	m := &Manager{}
+	m.registerMetrics()
+	return m
+}
+
+// AddQWAC loads an mTLS certificate and key; failing here stops startup
+func (m *Manager) AddQWAC(name, certPath, keyPath string) (*Cert, error) {
+	return m.add(&Cert{Name: name, Kind: KindQWAC, certPath: certPath, keyPath: keyPath})
+}
+
+// AddQSEAL loads a QSEAL certificate and/or file key. keyPath is empty when an HSM or remote
+// signer holds the key; certPath is optional for file keys.
+func (m *Manager) AddQSEAL(name, certPath, keyPath string) (*Cert, error) {
+	return m.add(&Cert{Name: name, Kind: KindQSEAL, certPath: certPath, keyPath: keyPath})
+}
+
+func (m *Manager) add(c *Cert) (*Cert, error) {
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", c.Kind, c.Name, err)
+	}
+	m.mu.Lock()
+	m.certs = append(m.certs, c)
+	m.mu.Unlock()
+	return c, nil
+}
+
+// Certs lists everything managed, in the order added
+func (m *Manager) Certs() []*Cert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Cert(nil), m.certs...)
+}
+
+// Run polls for file changes and checks expiry until ctx ends
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	m.checkExpiry(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			for _, c := range m.Certs() {
+				c.reloadIfChanged()
+			}
+			m.checkExpiry(time.Now())
+		}
+	}
+}
+
+func (c *Cert) reloadIfChanged() {
+	mod := c.statFiles()
+	c.mu.RLock()
+	changed := mod != c.modTimes
+	c.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	// A half-written file fails to load; the old material stays in use and we retry next tick
+	if err := c.load(); err != nil {
+		log.Printf("%s %s: reload failed, keeping previous: %v", c.Kind, c.Name, err)
+		return
+	}
+	log.Printf("%s %s: reloaded", c.Kind, c.Name)
+
+	c.mu.RLock()
+	hooks := append([]func(){}, c.onReload...)
+	c.mu.RUnlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
+func (c *Cert) statFiles() [2]time.Time {
+	var mod [2]time.Time
+	for i, p := range []string{c.certPath, c.keyPath} {
+		if p == "" {
+			continue
+		}
+		if st, err := os.Stat(p); err == nil {
+			mod[i] = st.ModTime()
+		}
+	}
+	return mod
+}
+
+func (c *Cert) load() error {
+	mod := c.statFiles()
+	err := c.loadFiles()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+	// Remembered even on failure: a broken file is reported once, fixing it changes the mtime again
+	c.modTimes = mod
+	if err == nil {
+		c.reloads++
+		// A new certificate starts its warnings from scratch
+		c.warnLevel = 0
+	}
+	return err
+}
+
+func (c *Cert) loadFiles() error {
+	var chain []*x509.Certificate
+	var tlsCert *tls.Certificate
+	var sealKey crypto.Signer
+
+	switch c.Kind {
+	case KindQWAC:
+		pair, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+		if err != nil {
+			return err
+		}
+		for _, der := range pair.Certificate {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return err
+			}
+			chain = append(chain, cert)
+		}
+		tlsCert = &pair
+	case KindQSEAL:
+		var err error
+		if c.certPath != "" {
+			if chain, err = readChain(c.certPath); err != nil {
+				return err
+			}
+		}
+		if c.keyPath != "" {
+			if sealKey, err = opjwt.LoadPrivateKeyFromPEM(c.keyPath); err != nil {
+				return err
+			}
+			if len(chain) > 0 && !SameKey(chain[0].PublicKey, sealKey.Public()) {
+				return errors.New("certificate does not match the key")
+			}
+		}
+	}
+
+	// The kid is fixed at startup, and verifiers cache keys by kid: a QSEAL key swapped under
+	// the same kid would fail every signature they check. Renewed certificates are fine.
+	if c.Kind == KindQSEAL {
+		if prev := c.publicKey(); prev != nil && !SameKey(prev, publicKeyOf(chain, sealKey)) {
+			return errors.New("key changed but the kid did not: publish the new key under a new kid and restart")
+		}
+	}
+
+	var info *Info
+	if len(chain) > 0 {
+		parsed, err := ParseInfo(chain[0])
+		if err != nil {
+			return err
+		}
+		info = &parsed
+	}
+
+	c.mu.Lock()
+	c.tlsCert = tlsCert
+	c.sealKey = sealKey
+	c.chain = chain
+	c.info = info
+	c.mu.Unlock()
+	return nil
+}
+
+// publicKey is the key of the loaded material, nil before the first load
+func (c *Cert) publicKey() crypto.PublicKey {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return publicKeyOf(c.chain, c.sealKey)
+}
+
+func publicKeyOf(chain []*x509.Certificate, key crypto.Signer) crypto.PublicKey {
+	switch {
+	case len(chain) > 0:
+		return chain[0].PublicKey
+	case key != nil:
+		return key.Public()
+	}
+	return nil
+}
+
+// SameKey compares public keys of any standard type
+func SameKey(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+// readChain reads every certificate in a PEM file, leaf first
+func readChain(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no PEM certificate in %s", path)
+	}
+	return chain, nil
+}
@@ -0,0 +1,111 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// ETSI EN 319 412-5 (QCStatements) and TS 119 495 (PSD2 roles)
+var (
+	oidQCStatements           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+	oidQcCompliance           = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}
+	oidQcType                 = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6}
+	oidPSD2QcType             = asn1.ObjectIdentifier{0, 4, 0, 19495, 2}
+	oidOrganizationIdentifier = asn1.ObjectIdentifier{2, 5, 4, 97}
+)
+
+var qcTypeNames = map[string]string{
+	"0.4.0.1862.1.6.1": "esign",
+	"0.4.0.1862.1.6.2": "eseal",
+	"0.4.0.1862.1.6.3": "web",
+}
+
+// Info is what we report about a certificate: validity and its PSD2 attributes
+type Info struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+
+	Qualified bool     `json:"qualified"`         // QcCompliance statement present
+	QCTypes   []string `json:"qcTypes,omitempty"` // esign | eseal | web
+	PSD2Roles []string `json:"psd2Roles,omitempty"`
+	NCAName   string   `json:"ncaName,omitempty"`
+	NCAID     string   `json:"ncaId,omitempty"`
+	// TPP authorization number from the subject organizationIdentifier, e.g. PSDFI-FINFSA-29884997
+	AuthorizationNumber string `json:"authorizationNumber,omitempty"`
+}
+
+type qcStatement struct {
+	ID   asn1.ObjectIdentifier
+	Info asn1.RawValue `asn1:"optional"`
+}
+
+type psd2QcType struct {
+	Roles   []roleOfPSP
+	NCAName string `asn1:"utf8"`
+	NCAID   string `asn1:"utf8"`
+}
+
+type roleOfPSP struct {
+	ID   asn1.ObjectIdentifier
+	Name string `asn1:"utf8"`
+}
+
+// ParseInfo reads validity and eIDAS attributes. Malformed QCStatements are an error,
+// a certificate without them is not (e.g. self-signed sandbox certificates).
+func ParseInfo(cert *x509.Certificate) (Info, error) {
+	info := Info{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		Serial:    hex.EncodeToString(cert.SerialNumber.Bytes()),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	for _, n := range cert.Subject.Names {
+		if n.Type.Equal(oidOrganizationIdentifier) {
+			info.AuthorizationNumber, _ = n.Value.(string)
+		}
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidQCStatements) {
+			continue
+		}
+		var stmts []qcStatement
+		if _, err := asn1.Unmarshal(ext.Value, &stmts); err != nil {
+			return info, fmt.Errorf("parse QCStatements: %w", err)
+		}
+		for _, st := range stmts {
+			switch {
+			case st.ID.Equal(oidQcCompliance):
+				info.Qualified = true
+			case st.ID.Equal(oidQcType):
+				var types []asn1.ObjectIdentifier
+				if _, err := asn1.Unmarshal(st.Info.FullBytes, &types); err != nil {
+					return info, fmt.Errorf("parse QcType: %w", err)
+				}
+				for _, t := range types {
+					if name, ok := qcTypeNames[t.String()]; ok {
+						info.QCTypes = append(info.QCTypes, name)
+					}
+				}
+			case st.ID.Equal(oidPSD2QcType):
+				var psd2 psd2QcType
+				if _, err := asn1.Unmarshal(st.Info.FullBytes, &psd2); err != nil {
+					return info, fmt.Errorf("parse PSD2 QcType: %w", err)
+				}
+				for _, r := range psd2.Roles {
+					info.PSD2Roles = append(info.PSD2Roles, r.Name)
+				}
+				info.NCAName = psd2.NCAName
+				info.NCAID = psd2.NCAID
+			}
+		}
+	}
+	return info, nil
+}
@@ -1,41 +1,232 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
+// Config is built from defaults, then an optional YAML file (CONFIG_FILE), then env vars.
+// Each field names its env var; secret fields also accept <NAME>_FILE (Docker/Kubernetes secrets).
 type Config struct {
-	DatabaseURL string
-	JWTSecret   string
-
-	OPMTLSBase       string
-	OPAuthBase       string
-	OPClientID       string
-	OPClientSecret   string
-	OPAPIKey         string
-	OPFAPIFinancialID string
-	OPRedirectURI    string
-	OPQWACCertPath   string
-	OPQWACKeyPath    string
-	OPQSEALKeyPath   string
-	OPQSEALKid       string
-}
-
-func Load() Config {
+	// production refuses sandbox OP endpoints and debug logging of client ids
+	Environment string `yaml:"environment" env:"APP_ENV"` // development | production
+
+	DatabaseURL string `yaml:"database_url" env:"DATABASE_URL" secret:"url"`
+	JWTSecret   string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+
+	// cookie: login sets HttpOnly session cookies instead of returning tokens (bearer headers
+	// keep working); the frontend must then send X-CSRF-Token on state-changing requests
+	SessionMode           string `yaml:"session_mode" env:"SESSION_MODE"`                       // bearer | cookie
+	SessionCookieSameSite string `yaml:"session_cookie_samesite" env:"SESSION_COOKIE_SAMESITE"` // strict | lax | none
+	SessionCookieDomain   string `yaml:"session_cookie_domain" env:"SESSION_COOKIE_DOMAIN"`     // empty: host only
+
+	AuthLimiterBackend string `yaml:"auth_limiter_backend" env:"AUTH_LIMITER_BACKEND"` // memory | postgres
+
+	PasswordMinLength      int    `yaml:"password_min_length" env:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength      int    `yaml:"password_max_length" env:"PASSWORD_MAX_LENGTH"`
+	PasswordBreachDir      string `yaml:"password_breach_dir" env:"PASSWORD_BREACH_DIR"` // local Pwned Passwords range files, empty disables the check
+	PasswordBreachMinCount int    `yaml:"password_breach_min_count" env:"PASSWORD_BREACH_MIN_COUNT"`
+
+	OIDCProviders []OIDCProvider `yaml:"oidc_providers"`
+	// Frontend page the provider callback sends the browser to, with the outcome in the fragment
+	OIDCFrontendURL string `yaml:"oidc_frontend_url" env:"OIDC_FRONTEND_URL"` // defaults to PUBLIC_BASE_URL
+
+	ExportDir     string `yaml:"export_dir" env:"EXPORT_DIR"`           // GDPR export archives
+	PublicBaseURL string `yaml:"public_base_url" env:"PUBLIC_BASE_URL"` // used in links sent to users
+
+	// Browser access from the frontend origin(s); empty allows no cross-origin calls
+	CORSAllowedOrigins   []string `yaml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS"` // comma separated, e.g. https://app.example.com
+	CORSAllowCredentials bool     `yaml:"cors_allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge           int      `yaml:"cors_max_age" env:"CORS_MAX_AGE"` // seconds browsers may cache a preflight
+	HSTSMaxAge           int      `yaml:"hsts_max_age" env:"HSTS_MAX_AGE"` // seconds, sent only when PUBLIC_BASE_URL is https
+
+	// Listener for /metrics, kept off the public port; bind it where only the scraper reaches
+	MetricsAddr string `yaml:"metrics_addr" env:"METRICS_ADDR"`
+
+	// Seconds between failing /readyz and closing the listener on shutdown, so load balancers
+	// notice and stop routing new requests here first
+	ShutdownDelay int `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+
+	// Seconds a response stays replayable under its Idempotency-Key
+	IdempotencyWindow int `yaml:"idempotency_window" env:"IDEMPOTENCY_WINDOW"`
+
+	// Checks responses against /openapi.json: log reports divergences, enforce also turns them into 500s
+	OpenAPIContract string `yaml:"openapi_contract" env:"OPENAPI_CONTRACT"` // off | log | enforce
+
+	TracesExporter   string `yaml:"traces_exporter" env:"OTEL_TRACES_EXPORTER"` // none | stdout | otlp (standard OTEL_* variable names)
+	OTLPEndpoint     string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	TraceServiceName string `yaml:"trace_service_name" env:"OTEL_SERVICE_NAME"`
+
+	// Flat OP_* settings describe a single OP environment. They are used when the file has no
+	// op_environments list; empty URLs are filled in from OP_PROFILE.
+	OPProfile         string   `yaml:"op_profile" env:"OP_PROFILE"` // sandbox | production
+	OPMTLSBase        string   `yaml:"op_mtls_base" env:"OP_MTLS_BASE"`
+	OPAuthBase        string   `yaml:"op_auth_base" env:"OP_AUTH_BASE"`
+	OPClientID        string   `yaml:"op_client_id" env:"OP_CLIENT_ID"`
+	OPClientSecret    string   `yaml:"op_client_secret" env:"OP_CLIENT_SECRET" secret:"true"`
+	OPAPIKey          string   `yaml:"op_api_key" env:"OP_API_KEY" secret:"true"`
+	OPFAPIFinancialID string   `yaml:"op_fapi_financial_id" env:"OP_FAPI_FINANCIAL_ID"`
+	OPRedirectURI     string   `yaml:"op_redirect_uri" env:"OP_REDIRECT_URI"`
+	OPRequestAud      string   `yaml:"op_request_aud" env:"OP_REQUEST_AUD"` // audience of request objects, defaults to OPMTLSBase
+	OPQWACCertPath    string   `yaml:"op_qwac_cert_path" env:"OP_QWAC_CERT_PATH"`
+	OPQWACKeyPath     string   `yaml:"op_qwac_key_path" env:"OP_QWAC_KEY_PATH"`
+	OPQSEALKeyPath    string   `yaml:"op_qseal_key_path" env:"OP_QSEAL_KEY_PATH"`
+	OPQSEALCertPath   string   `yaml:"op_qseal_cert_path" env:"OP_QSEAL_CERT_PATH"` // optional, enables expiry and role reporting
+	OPQSEALKid        string   `yaml:"op_qseal_kid" env:"OP_QSEAL_KID"`
+	OPQSEALSigner     string   `yaml:"op_qseal_signer" env:"OP_QSEAL_SIGNER"` // file | pkcs11 | remote
+	OPQSEALAlg        string   `yaml:"op_qseal_alg" env:"OP_QSEAL_ALG"`       // empty picks from the key type
+	OPQSEALPKCS11     PKCS11   `yaml:"op_qseal_pkcs11"`
+	OPQSEALRemote     Remote   `yaml:"op_qseal_remote"`
+	OPQSEALJWKSExtra  []string `yaml:"op_qseal_jwks_extra" env:"OP_QSEAL_JWKS_EXTRA"` // kid=cert.pem,... published during rotation
+	OPJWS             JWS      `yaml:"op_jws"`
+	OPIssuer          string   `yaml:"op_issuer" env:"OP_ISSUER"` // optional, not checked yet (see OPEnvironment.Issuer)
+	OPJWKSURL         string   `yaml:"op_jwks_url" env:"OP_JWKS_URL"`
+	OPCABundlePath    string   `yaml:"op_ca_bundle_path" env:"OP_CA_BUNDLE_PATH"`               // empty uses system roots
+	OPRedirectURIs    []string `yaml:"op_allowed_redirect_uris" env:"OP_ALLOWED_REDIRECT_URIS"` // comma separated, defaults to OP_REDIRECT_URI
+
+	// Several OP environments side by side, e.g. sandbox next to a production test account.
+	// The first one is the default; the flat OP_* settings must then be left empty.
+	OPEnvironments []OPEnvironment `yaml:"op_environments"`
+
+	OPDebugLogClientID bool `yaml:"op_debug_log_client_id" env:"OP_DEBUG_LOG_CLIENT_ID"` // not allowed in production
+
+	// Sanitized copies of OP requests and responses for debugging; off unless asked for
+	OPRecorder     string `yaml:"op_recorder" env:"OP_RECORDER"`           // off | memory | postgres
+	OPRecorderSize int    `yaml:"op_recorder_size" env:"OP_RECORDER_SIZE"` // ring buffer size for memory; postgres keeps 7 days
+}
+
+// OIDCProvider is one social / OIDC login provider, from the file or OIDC_<NAME>_* env vars
+type OIDCProvider struct {
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" secret:"true"`
+	RedirectURI  string   `yaml:"redirect_uri"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+func defaults() Config {
 	return Config{
-		DatabaseURL:       os.Getenv("DATABASE_URL"),
-		JWTSecret:         os.Getenv("JWT_SECRET"),
-
-		OPMTLSBase:        os.Getenv("OP_MTLS_BASE"),
-		OPAuthBase:        os.Getenv("OP_AUTH_BASE"),
-		OPClientID:        os.Getenv("OP_CLIENT_ID"),
-		OPClientSecret:    os.Getenv("OP_CLIENT_SECRET"),
-		OPAPIKey:          os.Getenv("OP_API_KEY"),
-		OPFAPIFinancialID: os.Getenv("OP_FAPI_FINANCIAL_ID"),
-		OPRedirectURI:     os.Getenv("OP_REDIRECT_URI"),
-		OPQWACCertPath:    os.Getenv("OP_QWAC_CERT_PATH"),
-		OPQWACKeyPath:     os.Getenv("OP_QWAC_KEY_PATH"),
-		OPQSEALKeyPath:    os.Getenv("OP_QSEAL_KEY_PATH"),
-		OPQSEALKid:        os.Getenv("OP_QSEAL_KID"),
+		Environment:            "development",
+		SessionMode:            "bearer",
+		SessionCookieSameSite:  "lax",
+		AuthLimiterBackend:     "memory",
+		PasswordMinLength:      10,
+		PasswordMaxLength:      128,
+		PasswordBreachMinCount: 1,
+		ExportDir:              filepath.Join(os.TempDir(), "opl-exports"),
+		PublicBaseURL:          "http://localhost:8080",
+		CORSMaxAge:             600,
+		ShutdownDelay:          5,
+		MetricsAddr:            ":9090",
+		HSTSMaxAge:             31536000,
+		IdempotencyWindow:      86400,
+		OpenAPIContract:        "off",
+		TracesExporter:         "none",
+		OTLPEndpoint:           "http://localhost:4318",
+		TraceServiceName:       "onepointledger-backend",
+		OPProfile:              "sandbox",
+		OPRecorder:             "off",
+		OPRecorderSize:         500,
+	}
+}
+
+// Load builds and validates the config. The error lists every problem found, not just the first.
+func Load() (Config, error) {
+	cfg := defaults()
+	var problems []string
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			// Nothing else is trustworthy without the file
+			return cfg, err
+		}
+	}
+	problems = append(problems, applyEnv(&cfg)...)
+
+	providers, envProblems := loadOIDCProviders(cfg.OIDCProviders)
+	cfg.OIDCProviders = providers
+	problems = append(problems, envProblems...)
+
+	cfg.OTLPEndpoint = strings.TrimRight(cfg.OTLPEndpoint, "/")
+	if cfg.OIDCFrontendURL == "" {
+		cfg.OIDCFrontendURL = cfg.PublicBaseURL
+	}
+
+	envs, envProblems := cfg.loadOPEnvironments()
+	cfg.OPEnvironments = envs
+	problems = append(problems, envProblems...)
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return cfg, &Error{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// Error reports all invalid settings at once
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// Only Google has a fixed issuer; Microsoft issuers are tenant specific and must be configured
+var defaultOIDCIssuers = map[string]string{
+	"google": "https://accounts.google.com",
+}
+
+// OIDC_PROVIDERS=google,microsoft enables providers by name and replaces any list from the file.
+// Without it, OIDC_<NAME>_* env vars still override fields of providers from the file.
+func loadOIDCProviders(fromFile []OIDCProvider) ([]OIDCProvider, []string) {
+	var names []string
+	byName := make(map[string]OIDCProvider)
+	for _, p := range fromFile {
+		p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+		names = append(names, p.Name)
+		byName[p.Name] = p
+	}
+	if list, ok := os.LookupEnv("OIDC_PROVIDERS"); ok {
+		names = nil
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var out []OIDCProvider
+	var problems []string
+	for _, name := range names {
+		p := byName[name]
+		p.Name = name
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		if v, ok := os.LookupEnv(prefix + "ISSUER"); ok {
+			p.Issuer = v
+		}
+		if v, ok := os.LookupEnv(prefix + "CLIENT_ID"); ok {
+			p.ClientID = v
+		}
+		if v, ok, err := lookupSecret(prefix + "CLIENT_SECRET"); err != nil {
+			problems = append(problems, err.Error())
+		} else if ok {
+			p.ClientSecret = v
+		}
+		if v, ok := os.LookupEnv(prefix + "REDIRECT_URI"); ok {
+			p.RedirectURI = v
+		}
+		if v, ok := os.LookupEnv(prefix + "SCOPES"); ok {
+			p.Scopes = strings.Fields(v)
+		}
+		if p.Issuer == "" {
+			p.Issuer = defaultOIDCIssuers[name]
+		}
+		out = append(out, p)
 	}
+	return out, problems
 }
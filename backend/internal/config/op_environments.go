@@ -0,0 +1,208 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// OPEnvironment is everything needed to talk to one OP PSD2 environment
+type OPEnvironment struct {
+	Name    string `yaml:"name"`
+	Profile string `yaml:"profile"` // sandbox | production, fills in the endpoints below when empty
+
+	MTLSBase     string   `yaml:"mtls_base"`
+	AuthBase     string   `yaml:"auth_base"`
+	Issuer       string   `yaml:"issuer"`   // reserved for the iss of OP id tokens; nothing verifies those yet
+	JWKSURL      string   `yaml:"jwks_url"` // OP signing keys
+	CABundlePath string   `yaml:"ca_bundle_path"`
+	RedirectURIs []string `yaml:"allowed_redirect_uris"`
+
+	ClientID        string `yaml:"client_id"`
+	ClientSecret    string `yaml:"client_secret" secret:"true"`
+	APIKey          string `yaml:"api_key" secret:"true"`
+	FAPIFinancialID string `yaml:"fapi_financial_id"`
+	RedirectURI     string `yaml:"redirect_uri"`
+	RequestAud      string `yaml:"request_aud"` // audience of request objects, defaults to MTLSBase
+	QWACCertPath    string `yaml:"qwac_cert_path"`
+	QWACKeyPath     string `yaml:"qwac_key_path"`
+	QSEALKeyPath    string `yaml:"qseal_key_path"`
+	QSEALCertPath   string `yaml:"qseal_cert_path"`
+	QSEALKid        string `yaml:"qseal_kid"`
+	QSEALSigner     string `yaml:"qseal_signer"` // file | pkcs11 | remote
+	QSEALAlg        string `yaml:"qseal_alg"`    // RS256 | PS256 | ES256 | ES384, empty picks from the key type
+	QSEALPKCS11     PKCS11 `yaml:"qseal_pkcs11"`
+	QSEALRemote     Remote `yaml:"qseal_remote"`
+	// Extra certificates published in our JWKS but not signed with, as kid=cert.pem:
+	// the next key before switching to it, the previous one until its tokens expired
+	QSEALJWKSExtra []string `yaml:"qseal_jwks_extra"`
+	// Detached x-jws-signature on request bodies, for APIs that require it
+	JWS JWS `yaml:"jws"`
+}
+
+// PKCS11 locates a QSEAL key on an HSM token (SoftHSM in development)
+type PKCS11 struct {
+	Module     string `yaml:"module" env:"OP_QSEAL_PKCS11_MODULE"`
+	TokenLabel string `yaml:"token_label" env:"OP_QSEAL_PKCS11_TOKEN_LABEL"`
+	KeyLabel   string `yaml:"key_label" env:"OP_QSEAL_PKCS11_KEY_LABEL"`
+	PIN        string `yaml:"pin" env:"OP_QSEAL_PKCS11_PIN" secret:"true"`
+}
+
+// Remote is an HTTP signing service holding the QSEAL key
+type Remote struct {
+	URL   string `yaml:"url" env:"OP_QSEAL_REMOTE_URL"`
+	Token string `yaml:"token" env:"OP_QSEAL_REMOTE_TOKEN" secret:"true"`
+	KeyID string `yaml:"key_id" env:"OP_QSEAL_REMOTE_KEY_ID"`
+}
+
+// JWS selects the endpoints whose request bodies are signed with the QSEAL. Responses carrying
+// x-jws-signature are always verified against jwks_url.
+type JWS struct {
+	Endpoints   []string `yaml:"endpoints" env:"OP_JWS_ENDPOINTS"`       // endpoint names, e.g. payments.create
+	Unencoded   bool     `yaml:"unencoded" env:"OP_JWS_UNENCODED"`       // b64=false
+	Issuer      string   `yaml:"issuer" env:"OP_JWS_ISSUER"`             // sets the openbanking.org.uk iat/iss/tan headers
+	TrustAnchor string   `yaml:"trust_anchor" env:"OP_JWS_TRUST_ANCHOR"` // openbanking.org.uk/tan, required with issuer
+	// openbanking.org.uk/iss OP signs its responses with; empty refuses responses that make it critical
+	BankIssuer string `yaml:"bank_issuer" env:"OP_JWS_BANK_ISSUER"`
+}
+
+const (
+	OPProfileSandbox    = "sandbox"
+	OPProfileProduction = "production"
+)
+
+// Endpoints OP publishes for each environment
+var opProfiles = map[string]OPEnvironment{
+	OPProfileSandbox: {
+		MTLSBase: "https://psd2.mtls.sandbox.apis.op.fi",
+		AuthBase: "https://authorize.psd2-sandbox.op.fi",
+		JWKSURL:  "https://authorize.psd2-sandbox.op.fi/oauth/jwks",
+	},
+	OPProfileProduction: {
+		MTLSBase: "https://psd2.mtls.apis.op.fi",
+		AuthBase: "https://authorize.psd2.op.fi",
+		JWKSURL:  "https://authorize.psd2.op.fi/oauth/jwks",
+	},
+}
+
+// loadOPEnvironments returns the op_environments list, or a single environment built from the
+// flat OP_* settings. Secrets of listed environments come from OP_<NAME>_CLIENT_SECRET / _API_KEY
+// (or their _FILE variants), like OIDC providers.
+func (c Config) loadOPEnvironments() ([]OPEnvironment, []string) {
+	var problems []string
+
+	envs := c.OPEnvironments
+	if len(envs) == 0 {
+		envs = []OPEnvironment{{
+			Name:            c.OPProfile,
+			Profile:         c.OPProfile,
+			MTLSBase:        c.OPMTLSBase,
+			AuthBase:        c.OPAuthBase,
+			Issuer:          c.OPIssuer,
+			JWKSURL:         c.OPJWKSURL,
+			CABundlePath:    c.OPCABundlePath,
+			RedirectURIs:    c.OPRedirectURIs,
+			ClientID:        c.OPClientID,
+			ClientSecret:    c.OPClientSecret,
+			APIKey:          c.OPAPIKey,
+			FAPIFinancialID: c.OPFAPIFinancialID,
+			RedirectURI:     c.OPRedirectURI,
+			RequestAud:      c.OPRequestAud,
+			QWACCertPath:    c.OPQWACCertPath,
+			QWACKeyPath:     c.OPQWACKeyPath,
+			QSEALKeyPath:    c.OPQSEALKeyPath,
+			QSEALCertPath:   c.OPQSEALCertPath,
+			QSEALKid:        c.OPQSEALKid,
+			QSEALSigner:     c.OPQSEALSigner,
+			QSEALAlg:        c.OPQSEALAlg,
+			QSEALPKCS11:     c.OPQSEALPKCS11,
+			QSEALRemote:     c.OPQSEALRemote,
+			QSEALJWKSExtra:  c.OPQSEALJWKSExtra,
+			JWS:             c.OPJWS,
+		}}
+	} else {
+		if c.OPMTLSBase != "" || c.OPClientID != "" || c.OPQWACCertPath != "" {
+			problems = append(problems, "op_environments and flat OP_* settings are both set; use one of them")
+		}
+		envs = append([]OPEnvironment(nil), envs...)
+		for i := range envs {
+			prefix := "OP_" + strings.ToUpper(envs[i].Name) + "_"
+			if v, ok, err := lookupSecret(prefix + "CLIENT_SECRET"); err != nil {
+				problems = append(problems, err.Error())
+			} else if ok {
+				envs[i].ClientSecret = v
+			}
+			if v, ok, err := lookupSecret(prefix + "API_KEY"); err != nil {
+				problems = append(problems, err.Error())
+			} else if ok {
+				envs[i].APIKey = v
+			}
+			if v, ok, err := lookupSecret(prefix + "QSEAL_PKCS11_PIN"); err != nil {
+				problems = append(problems, err.Error())
+			} else if ok {
+				envs[i].QSEALPKCS11.PIN = v
+			}
+			if v, ok, err := lookupSecret(prefix + "QSEAL_REMOTE_TOKEN"); err != nil {
+				problems = append(problems, err.Error())
+			} else if ok {
+				envs[i].QSEALRemote.Token = v
+			}
+		}
+	}
+
+	for i := range envs {
+		e := &envs[i]
+		e.Name = strings.ToLower(strings.TrimSpace(e.Name))
+		defaults := opProfiles[e.Profile]
+		fill(&e.MTLSBase, defaults.MTLSBase)
+		fill(&e.AuthBase, defaults.AuthBase)
+		fill(&e.JWKSURL, defaults.JWKSURL)
+		fill(&e.RequestAud, e.MTLSBase)
+		fill(&e.QSEALSigner, "file")
+		if len(e.RedirectURIs) == 0 && e.RedirectURI != "" {
+			e.RedirectURIs = []string{e.RedirectURI}
+		}
+	}
+	return envs, problems
+}
+
+// JWKSKey is a certificate published in our JWKS under kid
+type JWKSKey struct {
+	Kid      string
+	CertPath string
+}
+
+// JWKSExtraKeys splits the kid=cert.pem entries, in order; malformed ones are reported by validation
+func (e OPEnvironment) JWKSExtraKeys() []JWKSKey {
+	var out []JWKSKey
+	for _, entry := range e.QSEALJWKSExtra {
+		if kid, path, ok := strings.Cut(entry, "="); ok {
+			out = append(out, JWKSKey{Kid: strings.TrimSpace(kid), CertPath: strings.TrimSpace(path)})
+		}
+	}
+	return out
+}
+
+func fill(field *string, def string) {
+	if *field == "" {
+		*field = def
+	}
+}
+
+// isSandboxURL spots sandbox endpoints, including custom ones, so production cannot use them by mistake
+func isSandboxURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, "sandbox") {
+		return true
+	}
+	sandbox := opProfiles[OPProfileSandbox]
+	for _, s := range []string{sandbox.MTLSBase, sandbox.AuthBase, sandbox.JWKSURL} {
+		if su, err := url.Parse(s); err == nil && su.Hostname() == host {
+			return true
+		}
+	}
+	return false
+}
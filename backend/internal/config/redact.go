@@ -0,0 +1,62 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[redacted]"
+
+// Redacted returns a copy safe to print or log: secrets are masked, URLs lose their password
+func (c Config) Redacted() Config {
+	out := c
+	redactStruct(reflect.ValueOf(&out).Elem())
+
+	out.OIDCProviders = make([]OIDCProvider, len(c.OIDCProviders))
+	for i, p := range c.OIDCProviders {
+		redactStruct(reflect.ValueOf(&p).Elem())
+		out.OIDCProviders[i] = p
+	}
+	out.OPEnvironments = make([]OPEnvironment, len(c.OPEnvironments))
+	for i, e := range c.OPEnvironments {
+		redactStruct(reflect.ValueOf(&e).Elem())
+		out.OPEnvironments[i] = e
+	}
+	return out
+}
+
+// YAML renders the effective config in the config file format
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func redactStruct(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			redactStruct(field)
+			continue
+		}
+		if field.Kind() != reflect.String || field.String() == "" {
+			continue
+		}
+		switch t.Field(i).Tag.Get("secret") {
+		case "true":
+			field.SetString(redacted)
+		case "url":
+			field.SetString(redactURL(field.String()))
+		}
+	}
+}
+
+// postgres://user:pw@host/db keeps everything but the password; DSNs that do not parse are hidden
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return redacted
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile overlays a YAML config file. Unknown keys are rejected so typos do not go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("config file %s: only YAML (.yaml, .yml) is supported", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides fields from their env var (or <NAME>_FILE for secrets).
+// Set but empty variables count as set, so env can blank out a file value.
+func applyEnv(cfg *Config) []string {
+	return applyEnvStruct(reflect.ValueOf(cfg).Elem())
+}
+
+func applyEnvStruct(v reflect.Value) []string {
+	var problems []string
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// Nested settings groups carry their own env tags
+		if f.Type.Kind() == reflect.Struct {
+			problems = append(problems, applyEnvStruct(v.Field(i))...)
+			continue
+		}
+		name := f.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		var raw string
+		var ok bool
+		if f.Tag.Get("secret") != "" {
+			var err error
+			raw, ok, err = lookupSecret(name)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+		} else {
+			raw, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			continue
+		}
+
+		switch f.Type.Kind() {
+		case reflect.String:
+			v.Field(i).SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not an integer", name, raw))
+				continue
+			}
+			v.Field(i).SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(strings.TrimSpace(raw))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a boolean", name, raw))
+				continue
+			}
+			v.Field(i).SetBool(b)
+		case reflect.Slice:
+			// Comma separated list
+			var list []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			v.Field(i).Set(reflect.ValueOf(list))
+		}
+	}
+	return problems
+}
+
+// lookupSecret reads NAME, or the file named by NAME_FILE. Setting both is an error.
+func lookupSecret(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	path, fileOK := os.LookupEnv(name + "_FILE")
+	switch {
+	case ok && fileOK:
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", name, name)
+	case fileOK:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %v", name, err)
+		}
+		// Secret files usually end with a newline
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	default:
+		return value, ok, nil
+	}
+}
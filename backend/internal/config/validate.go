@@ -0,0 +1,293 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func (c Config) validate() []string {
+	var p problems
+
+	p.required("DATABASE_URL", c.DatabaseURL)
+	p.required("JWT_SECRET", c.JWTSecret)
+	p.oneOf("AUTH_LIMITER_BACKEND", c.AuthLimiterBackend, "memory", "postgres")
+	p.oneOf("OTEL_TRACES_EXPORTER", c.TracesExporter, "none", "stdout", "otlp")
+	if c.TracesExporter == "otlp" {
+		p.httpURL("OTEL_EXPORTER_OTLP_ENDPOINT", c.OTLPEndpoint)
+	}
+	p.httpURL("PUBLIC_BASE_URL", c.PublicBaseURL)
+
+	for _, o := range c.CORSAllowedOrigins {
+		switch {
+		case o == "*" && c.CORSAllowCredentials:
+			p.add("CORS_ALLOWED_ORIGINS: * cannot be combined with CORS_ALLOW_CREDENTIALS")
+		case o != "*" && !isOrigin(o):
+			p.add("CORS_ALLOWED_ORIGINS: %q is not an origin (scheme://host[:port])", o)
+		}
+	}
+	p.oneOf("SESSION_MODE", c.SessionMode, "bearer", "cookie")
+	p.oneOf("SESSION_COOKIE_SAMESITE", c.SessionCookieSameSite, "strict", "lax", "none")
+	if c.SessionMode == "cookie" {
+		// Browsers drop SameSite=None cookies that are not Secure
+		if c.SessionCookieSameSite == "none" && !strings.HasPrefix(c.PublicBaseURL, "https://") {
+			p.add("SESSION_COOKIE_SAMESITE: none needs an https PUBLIC_BASE_URL")
+		}
+		if len(c.CORSAllowedOrigins) > 0 && !c.CORSAllowCredentials {
+			p.add("SESSION_MODE: cookie sessions from another origin need CORS_ALLOW_CREDENTIALS")
+		}
+		if c.Environment == "production" && !strings.HasPrefix(c.PublicBaseURL, "https://") {
+			p.add("SESSION_MODE: cookie sessions in production need an https PUBLIC_BASE_URL")
+		}
+	}
+	if c.CORSMaxAge < 0 {
+		p.add("CORS_MAX_AGE: must not be negative, got %d", c.CORSMaxAge)
+	}
+	if c.HSTSMaxAge < 0 {
+		p.add("HSTS_MAX_AGE: must not be negative, got %d", c.HSTSMaxAge)
+	}
+	if _, _, err := net.SplitHostPort(c.MetricsAddr); err != nil {
+		p.add("METRICS_ADDR: %q is not host:port", c.MetricsAddr)
+	}
+	if c.ShutdownDelay < 0 {
+		p.add("SHUTDOWN_DELAY: must not be negative, got %d", c.ShutdownDelay)
+	}
+	if c.IdempotencyWindow < 60 {
+		p.add("IDEMPOTENCY_WINDOW: must be at least 60 seconds, got %d", c.IdempotencyWindow)
+	}
+
+	if c.PasswordMinLength < 8 {
+		p.add("PASSWORD_MIN_LENGTH: must be at least 8, got %d", c.PasswordMinLength)
+	}
+	if c.PasswordMaxLength < c.PasswordMinLength {
+		p.add("PASSWORD_MAX_LENGTH: must not be below PASSWORD_MIN_LENGTH (%d < %d)", c.PasswordMaxLength, c.PasswordMinLength)
+	}
+	if c.PasswordBreachMinCount < 1 {
+		p.add("PASSWORD_BREACH_MIN_COUNT: must be at least 1, got %d", c.PasswordBreachMinCount)
+	}
+	if c.PasswordBreachDir != "" {
+		p.dir("PASSWORD_BREACH_DIR", c.PasswordBreachDir)
+	}
+
+	p.httpURL("OIDC_FRONTEND_URL", c.OIDCFrontendURL)
+	if strings.Contains(c.OIDCFrontendURL, "#") {
+		p.add("OIDC_FRONTEND_URL: must not have a fragment, the sign in outcome goes there")
+	}
+	seen := make(map[string]bool)
+	for _, o := range c.OIDCProviders {
+		prefix := "OIDC provider " + o.Name
+		if o.Name == "" {
+			p.add("OIDC provider without a name")
+			continue
+		}
+		if seen[o.Name] {
+			p.add("%s: configured twice", prefix)
+		}
+		seen[o.Name] = true
+		p.httpURL(prefix+" issuer", o.Issuer)
+		p.required(prefix+" client id", o.ClientID)
+		p.httpURL(prefix+" redirect uri", o.RedirectURI)
+	}
+
+	p.oneOf("APP_ENV", c.Environment, "development", "production")
+	production := c.Environment == "production"
+	if production && c.OPDebugLogClientID {
+		p.add("OP_DEBUG_LOG_CLIENT_ID: debug logging of client ids is not allowed in production")
+	}
+	p.oneOf("OPENAPI_CONTRACT", c.OpenAPIContract, "off", "log", "enforce")
+	if production && c.OpenAPIContract == "enforce" {
+		p.add("OPENAPI_CONTRACT: enforce is for development and CI, use log in production")
+	}
+	p.oneOf("OP_RECORDER", c.OPRecorder, "off", "memory", "postgres")
+	if c.OPRecorderSize < 1 {
+		p.add("OP_RECORDER_SIZE: must be at least 1, got %d", c.OPRecorderSize)
+	}
+
+	names := make(map[string]bool)
+	for _, e := range c.OPEnvironments {
+		if e.Name == "" {
+			p.add("OP environment without a name")
+			continue
+		}
+		if names[e.Name] {
+			p.add("OP environment %s: configured twice", e.Name)
+		}
+		names[e.Name] = true
+		p.opEnvironment(e, production)
+	}
+	if len(c.OPEnvironments) == 0 {
+		p.add("no OP environment configured")
+	}
+
+	return p
+}
+
+// Required OP settings (for /connect/op/start), per environment
+func (p *problems) opEnvironment(e OPEnvironment, production bool) {
+	prefix := "OP environment " + e.Name + " "
+	p.oneOf(prefix+"profile", e.Profile, OPProfileSandbox, OPProfileProduction)
+
+	urls := map[string]string{
+		"mtls_base": e.MTLSBase,
+		"auth_base": e.AuthBase,
+		"issuer":    e.Issuer,
+		"jwks_url":  e.JWKSURL,
+	}
+	names := []string{"mtls_base", "auth_base", "jwks_url"}
+	// Optional until something checks the iss of OP tokens; still no sandbox URL in production
+	if e.Issuer != "" {
+		names = append(names, "issuer")
+	}
+	for _, name := range names {
+		p.httpURL(prefix+name, urls[name])
+		if production && isSandboxURL(urls[name]) {
+			p.add("%s%s: sandbox endpoint %s is not allowed in production", prefix, name, urls[name])
+		}
+	}
+	if production && e.Profile == OPProfileSandbox {
+		p.add("%sprofile: sandbox environments are not allowed in production", prefix)
+	}
+
+	p.required(prefix+"client_id", e.ClientID)
+	p.required(prefix+"client_secret", e.ClientSecret)
+	p.required(prefix+"api_key", e.APIKey)
+	p.required(prefix+"fapi_financial_id", e.FAPIFinancialID)
+	p.required(prefix+"request_aud", e.RequestAud)
+	p.required(prefix+"qseal_kid", e.QSEALKid)
+	p.oneOf(prefix+"qseal_alg", e.QSEALAlg, "", "RS256", "PS256", "ES256", "ES384")
+	p.oneOf(prefix+"qseal_signer", e.QSEALSigner, "file", "pkcs11", "remote")
+	switch e.QSEALSigner {
+	case "file":
+		p.file(prefix+"qseal_key_path", e.QSEALKeyPath)
+		if e.QSEALCertPath != "" {
+			p.file(prefix+"qseal_cert_path", e.QSEALCertPath)
+		}
+	case "pkcs11":
+		// The token does not hand out the public key we need for the JWT alg; the certificate does
+		p.file(prefix+"qseal_cert_path", e.QSEALCertPath)
+		p.file(prefix+"qseal_pkcs11.module", e.QSEALPKCS11.Module)
+		p.required(prefix+"qseal_pkcs11.token_label", e.QSEALPKCS11.TokenLabel)
+		p.required(prefix+"qseal_pkcs11.key_label", e.QSEALPKCS11.KeyLabel)
+		p.required(prefix+"qseal_pkcs11.pin", e.QSEALPKCS11.PIN)
+	case "remote":
+		p.file(prefix+"qseal_cert_path", e.QSEALCertPath)
+		p.httpURL(prefix+"qseal_remote.url", e.QSEALRemote.URL)
+		if production && !strings.HasPrefix(e.QSEALRemote.URL, "https://") {
+			p.add("%sqseal_remote.url: must use https in production", prefix)
+		}
+	}
+
+	kids := map[string]bool{e.QSEALKid: true}
+	for _, entry := range e.QSEALJWKSExtra {
+		kid, path, ok := strings.Cut(entry, "=")
+		kid, path = strings.TrimSpace(kid), strings.TrimSpace(path)
+		if !ok || kid == "" {
+			p.add("%sqseal_jwks_extra: %q is not kid=cert.pem", prefix, entry)
+			continue
+		}
+		if kids[kid] {
+			p.add("%sqseal_jwks_extra: kid %s is used twice", prefix, kid)
+		}
+		kids[kid] = true
+		p.file(prefix+"qseal_jwks_extra "+kid, path)
+	}
+
+	if e.JWS.Issuer != "" {
+		p.required(prefix+"jws.trust_anchor", e.JWS.TrustAnchor)
+	}
+
+	p.httpURL(prefix+"redirect_uri", e.RedirectURI)
+	allowed := false
+	for _, u := range e.RedirectURIs {
+		p.httpURL(prefix+"allowed_redirect_uris", u)
+		if production && !strings.HasPrefix(u, "https://") {
+			p.add("%sallowed_redirect_uris: %s must use https in production", prefix, u)
+		}
+		allowed = allowed || u == e.RedirectURI
+	}
+	if e.RedirectURI != "" && !allowed {
+		p.add("%sredirect_uri: %s is not in allowed_redirect_uris", prefix, e.RedirectURI)
+	}
+
+	if e.CABundlePath != "" {
+		p.file(prefix+"ca_bundle_path", e.CABundlePath)
+	}
+	certOK := p.file(prefix+"qwac_cert_path", e.QWACCertPath)
+	keyOK := p.file(prefix+"qwac_key_path", e.QWACKeyPath)
+	if certOK && keyOK {
+		if _, err := tls.LoadX509KeyPair(e.QWACCertPath, e.QWACKeyPath); err != nil {
+			p.add("%sqwac_cert_path/qwac_key_path: not a matching certificate and key: %v", prefix, err)
+		}
+	}
+}
+
+// problems collects validation failures so they can all be reported together
+type problems []string
+
+func (p *problems) add(format string, args ...any) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p *problems) required(name, value string) bool {
+	if value == "" {
+		p.add("%s is missing", name)
+		return false
+	}
+	return true
+}
+
+func (p *problems) oneOf(name, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	p.add("%s: %q is not one of %v", name, value, allowed)
+}
+
+func (p *problems) httpURL(name, value string) {
+	if !p.required(name, value) {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.add("%s: %q is not an absolute http(s) URL", name, value)
+	}
+}
+
+func (p *problems) file(name, path string) bool {
+	if !p.required(name, path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		p.add("%s: %v", name, err)
+		return false
+	}
+	if info.IsDir() {
+		p.add("%s: %s is a directory", name, path)
+		return false
+	}
+	return true
+}
+
+func (p *problems) dir(name, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		p.add("%s: %v", name, err)
+		return
+	}
+	if !info.IsDir() {
+		p.add("%s: %s is not a directory", name, path)
+	}
+}
+
+// isOrigin reports whether s is scheme://host[:port] with nothing after it
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
@@ -5,14 +5,19 @@ import (
 	"database/sql"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/tracing"
 )
 
 func Open(ctx context.Context, databaseURL string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", databaseURL)
+	connCfg, err := pgx.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, err
 	}
+	// Every query gets a span when tracing is enabled, a no-op otherwise
+	db := sql.OpenDB(tracing.WrapConnector(stdlib.GetConnector(*connCfg)))
 
 	// Safe defaults for Pool
 	db.SetMaxOpenConns(10)
@@ -30,3 +35,14 @@ func Open(ctx context.Context, databaseURL string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// SchemaVersion is the schema_version the code expects (see model/models.txt).
+// Bump it together with any schema change.
+const SchemaVersion = 6
+
+// CurrentSchemaVersion reads the version recorded by the last applied schema script
+func CurrentSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var v int
+	err := db.QueryRowContext(ctx, `SELECT version FROM schema_version;`).Scan(&v)
+	return v, err
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Sample is one value of a metric with its labels
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector is called on every scrape, so values are always current
+type Collector func() []Sample
+
+type metric struct {
+	name    string
+	help    string
+	kind    string // gauge | counter
+	collect Collector
+}
+
+var (
+	mu       sync.Mutex
+	registry = map[string]metric{}
+)
+
+// Gauge registers a gauge. Registering the same name again replaces it.
+func Gauge(name, help string, collect Collector) {
+	register(metric{name: name, help: help, kind: "gauge", collect: collect})
+}
+
+// Counter registers a monotonically increasing value
+func Counter(name, help string, collect Collector) {
+	register(metric{name: name, help: help, kind: "counter", collect: collect})
+}
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[m.name] = m
+}
+
+// Handler serves all metrics in the Prometheus text exposition format
+func Handler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	ms := make([]metric, 0, len(registry))
+	for _, m := range registry {
+		ms = append(ms, m)
+	}
+	mu.Unlock()
+	sort.Slice(ms, func(i, j int) bool { return ms[i].name < ms[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	var b strings.Builder
+	for _, m := range ms {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range m.collect() {
+			fmt.Fprintf(&b, "%s%s %g\n", m.name, labels(s.Labels), s.Value)
+		}
+	}
+	w.Write([]byte(b.String()))
+}
+
+func labels(l map[string]string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(l[k])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// ActivityEvent is an audit log entry as shown to the user it concerns
+type ActivityEvent struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`
+	IP        string    `json:"ip,omitempty"`
+	ByStaff   bool      `json:"byStaff"`
+	CreatedAt time.Time `json:"createdAt"`
+}
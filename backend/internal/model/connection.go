@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+const (
+	ConnectionPending           = "pending"
+	ConnectionReconsentRequired = "reconsent_required"
+)
+
+// Connection is a bank authorization of a user, without state/nonce secrets
+type Connection struct {
+	AuthorizationID string    `json:"authorizationId"`
+	Environment     string    `json:"environment"` // OP environment name, empty for the default
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is a GDPR export job; the archive is downloadable via a one-off link until ExpiresAt
+type DataExport struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"-"`
+	Status    string     `json:"status"`
+	FilePath  string     `json:"-"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is what is kept under an Idempotency-Key: the fingerprint of the first
+// request and, once it has been answered, its response
+type IdempotencyRecord struct {
+	Fingerprint string
+	Status      int // 0 while the first request is in flight
+	Header      map[string][]string
+	Body        []byte
+	ExpiresAt   time.Time
+	// CreatedAt tells this reservation apart from a later claim of the same key
+	CreatedAt time.Time
+}
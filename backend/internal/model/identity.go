@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Identity links an external OIDC account (provider + subject) to a user
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
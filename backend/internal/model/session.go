@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	MFALevel   string    `json:"mfaLevel"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+type SignInEvent struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"-"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -2,9 +2,34 @@ package model
 
 import "time"
 
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleSupport || role == RoleAdmin
+}
+
 type User struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID                string     `json:"id"`
+	Email             string     `json:"email"`
+	EmailVerified     bool       `json:"emailVerified"`
+	PasswordHash      string     `json:"-"`
+	DisplayName       string     `json:"displayName"`
+	Locale            string     `json:"locale"`
+	PreferredCurrency string     `json:"preferredCurrency"`
+	Timezone          string     `json:"timezone"`
+	Role              string     `json:"role"`
+	DisabledAt        *time.Time `json:"disabledAt,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+// ProfileUpdate holds the editable profile fields, nil means unchanged
+type ProfileUpdate struct {
+	DisplayName       *string `json:"displayName"`
+	Locale            *string `json:"locale"`
+	PreferredCurrency *string `json:"preferredCurrency"`
+	Timezone          *string `json:"timezone"`
 }
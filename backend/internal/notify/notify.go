@@ -0,0 +1,19 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Notifier delivers security notifications to users (email, push, ...).
+type Notifier interface {
+	Notify(ctx context.Context, email, subject, body string) error
+}
+
+// LogNotifier only logs the message. Used until a real mail provider is wired in.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, email, subject, body string) error {
+	log.Printf("notify %s: %s: %s", email, subject, body)
+	return nil
+}
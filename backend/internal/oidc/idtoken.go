@@ -0,0 +1,64 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the id_token claims we rely on
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"` // some providers send "true"
+	Name          string `json:"name"`
+	AZP           string `json:"azp"`
+}
+
+// Verify checks signature, issuer, audience, expiry and nonce of an id_token
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	if _, err := p.Discover(ctx); err != nil {
+		return Claims{}, err
+	}
+
+	var c idTokenClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &c, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("verify id_token: %w", err)
+	}
+
+	// Multiple audiences require azp to be us
+	if len(c.Audience) > 1 && c.AZP != p.ClientID {
+		return Claims{}, errors.New("id_token azp mismatch")
+	}
+	if c.Nonce == "" || c.Nonce != nonce {
+		return Claims{}, errors.New("id_token nonce mismatch")
+	}
+	if c.Subject == "" {
+		return Claims{}, errors.New("id_token missing sub")
+	}
+
+	verified := c.EmailVerified == true || c.EmailVerified == "true"
+	return Claims{Subject: c.Subject, Email: c.Email, EmailVerified: verified, Name: c.Name}, nil
+}
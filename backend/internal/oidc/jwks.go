@@ -0,0 +1,124 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksDoc struct {
+	Keys []jwk `json:"keys"`
+}
+
+// keySet caches the provider signing keys and refetches on an unknown kid (key rotation)
+type keySet struct {
+	uri     string
+	fetch   func(ctx context.Context, u string, v any) error
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newKeySet(uri string, fetch func(ctx context.Context, u string, v any) error) *keySet {
+	return &keySet{uri: uri, fetch: fetch}
+}
+
+func (k *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	// Do not let a stream of bogus kids hammer the provider
+	if time.Since(k.fetched) < 30*time.Second && k.keys != nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var doc jwksDoc
+	if err := k.fetch(ctx, k.uri, &doc); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, j := range doc.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		pub, err := j.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[j.Kid] = pub
+	}
+	k.keys = keys
+	k.fetched = time.Now()
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (j jwk) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := b64Int(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := b64Int(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
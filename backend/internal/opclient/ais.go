@@ -7,7 +7,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,17 +20,57 @@ type AISClient struct {
 	ClientSecret    string
 	APIKey          string
 	FAPIFinancialID string
+
+	// Client credentials token, reused until shortly before it expires
+	tokenMu  sync.Mutex
+	token    string
+	tokenExp time.Time
 }
 
+// Refresh this long before expires_in runs out, so a token never expires in flight
+const tokenExpiryMargin = 30 * time.Second
+
 type tokenResp struct {
 	AccessToken string `json:"access_token"`
 	TokenType   string `json:"token_type"`
 	Scope       string `json:"scope"`
-	ExpiresIn   any    `json:"expires_in"`
+	ExpiresIn   any    `json:"expires_in"` // number, or a string in some OP responses
 	Status      string `json:"status"`
 }
 
+// ClientCredentialsToken returns the cached token or fetches a new one
 func (c *AISClient) ClientCredentialsToken(ctx context.Context) (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExp) {
+		return c.token, nil
+	}
+	token, ttl, err := c.fetchToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Without a usable expires_in the token is not cached
+	if ttl > tokenExpiryMargin {
+		c.token = token
+		c.tokenExp = time.Now().Add(ttl - tokenExpiryMargin)
+	}
+	return token, nil
+}
+
+// invalidateToken drops a token OP no longer accepts
+func (c *AISClient) invalidateToken(token string) {
+	c.tokenMu.Lock()
+	if c.token == token {
+		c.token = ""
+	}
+	c.tokenMu.Unlock()
+}
+
+func (c *AISClient) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	// Asking for another token has no side effects at OP
+	ctx = WithRetrySafe(WithEndpoint(ctx, "oauth.token"))
+
 	form := url.Values{}
 	form.Set("grant_type", "client_credentials")
 	form.Set("scope", "accounts") // OP requirement: one scope per request
@@ -37,29 +79,41 @@ func (c *AISClient) ClientCredentialsToken(ctx context.Context) (string, error)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.MTLSBase+"/oauth/token", strings.NewReader(form.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("create token request: %w", err)
+		return "", 0, fmt.Errorf("create token request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("token request failed: %w", err)
+		return "", 0, fmt.Errorf("token request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode/100 != 2 {
-		return "", fmt.Errorf("token non-2xx: %s body=%s", resp.Status, string(body))
+		return "", 0, fmt.Errorf("token non-2xx: %s body=%s", resp.Status, string(body))
 	}
 
 	var tr tokenResp
 	if err := json.Unmarshal(body, &tr); err != nil {
-		return "", fmt.Errorf("parse token response: %w body=%s", err, string(body))
+		return "", 0, fmt.Errorf("parse token response: %w body=%s", err, string(body))
 	}
 	if tr.AccessToken == "" {
-		return "", fmt.Errorf("missing access_token in response body=%s", string(body))
+		return "", 0, fmt.Errorf("missing access_token in response body=%s", string(body))
 	}
-	return tr.AccessToken, nil
+	return tr.AccessToken, expiresIn(tr.ExpiresIn), nil
+}
+
+func expiresIn(v any) time.Duration {
+	switch x := v.(type) {
+	case float64:
+		return time.Duration(x) * time.Second
+	case string:
+		if n, err := strconv.Atoi(x); err == nil {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 0
 }
 
 type createAuthReq struct {
@@ -77,6 +131,7 @@ func (c *AISClient) CreateAuthorization(ctx context.Context, bearerToken string)
 	expires := time.Now().Add(1 * time.Hour).Format(time.RFC3339)
 	payload := fmt.Sprintf(`{"expires":"%s"}`, expires)
 
+	ctx = WithEndpoint(ctx, "authorizations.create")
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.MTLSBase+"/accounts-psd2/v1/authorizations", strings.NewReader(payload))
 	if err != nil {
 		return "", fmt.Errorf("create authorizations request: %w", err)
@@ -95,6 +150,9 @@ func (c *AISClient) CreateAuthorization(ctx context.Context, bearerToken string)
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.invalidateToken(bearerToken)
+	}
 	if resp.StatusCode/100 != 2 {
 		return "", fmt.Errorf("authorizations non-2xx: %s body=%s", resp.Status, string(body))
 	}
@@ -108,3 +166,35 @@ func (c *AISClient) CreateAuthorization(ctx context.Context, bearerToken string)
 	}
 	return ar.AuthorizationID, nil
 }
+
+// RevokeAuthorization withdraws a consent at OP. An authorization OP no longer knows counts as revoked.
+func (c *AISClient) RevokeAuthorization(ctx context.Context, bearerToken, authorizationID string) error {
+	ctx = WithEndpoint(ctx, "authorizations.revoke")
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.MTLSBase+"/accounts-psd2/v1/authorizations/"+url.PathEscape(authorizationID), nil)
+	if err != nil {
+		return fmt.Errorf("create revoke request: %w", err)
+	}
+
+	req.Header.Set("x-api-key", c.APIKey)
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	req.Header.Set("x-fapi-financial-id", c.FAPIFinancialID)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoke request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.invalidateToken(bearerToken)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("revoke non-2xx: %s body=%s", resp.Status, string(body))
+	}
+	return nil
+}
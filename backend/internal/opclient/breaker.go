@@ -0,0 +1,81 @@
+package opclient
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit states, also the values of the opl_op_circuit_state metric
+const (
+	CircuitClosed   = 0
+	CircuitHalfOpen = 1
+	CircuitOpen     = 2
+)
+
+var circuitNames = map[int]string{CircuitClosed: "closed", CircuitHalfOpen: "half_open", CircuitOpen: "open"}
+
+// breaker opens after consecutive failures and lets one probe through after a cool-down
+type breaker struct {
+	mu        sync.Mutex
+	state     int
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	coolDown  time.Duration
+}
+
+// allow reports whether a request may be sent now
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.coolDown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		// Only the one probe at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) record(ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ok {
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = now
+	}
+}
+
+// release ends a request that neither succeeded nor failed, e.g. canceled by the caller. A
+// half-open circuit stays half-open and lets the next probe through.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) current() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
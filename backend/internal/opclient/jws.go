@@ -0,0 +1,153 @@
+package opclient
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+)
+
+// ErrResponseSignature means the bank's x-jws-signature did not verify; the body is not trusted
+var ErrResponseSignature = errors.New("OP response signature invalid")
+
+// JWSPolicy says which requests carry a detached x-jws-signature and how it is built
+type JWSPolicy struct {
+	Signer crypto.Signer // QSEAL
+	Alg    string
+	Kid    string
+
+	// Endpoints (WithEndpoint names) whose request bodies are signed
+	Endpoints map[string]bool
+	// Unencoded signs with b64=false, as required by older Open Banking profiles
+	Unencoded bool
+	// Issuer turns on the openbanking.org.uk iat, iss and tan critical headers
+	Issuer      string
+	TrustAnchor string
+	// BankIssuer is the openbanking.org.uk/iss expected on response signatures
+	BankIssuer string
+
+	// Keys resolves the bank's signing keys; nil leaves response signatures unchecked
+	Keys func(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// JWSTransport signs request bodies and verifies signed responses. It wraps Resilient, so a
+// retried request is sent with the same signature.
+type JWSTransport struct {
+	Base   http.RoundTripper
+	Policy JWSPolicy
+}
+
+// Clock skew we accept on the bank's openbanking.org.uk/iat
+const jwsMaxSkew = 5 * time.Minute
+
+func (t *JWSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Policy.Endpoints[EndpointFromContext(req.Context())] {
+		signed, err := t.sign(req)
+		if err != nil {
+			return nil, err
+		}
+		req = signed
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil || t.Policy.Keys == nil {
+		return resp, err
+	}
+	sig := resp.Header.Get("x-jws-signature")
+	if sig == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read signed response: %w", err)
+	}
+	if err := t.verify(req.Context(), sig, body); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResponseSignature, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (t *JWSTransport) sign(req *http.Request) (*http.Request, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+		body = b
+	}
+
+	o := opjwt.DetachedOptions{Unencoded: t.Policy.Unencoded}
+	if t.Policy.Issuer != "" {
+		o.Header = map[string]any{
+			opjwt.HeaderOBIat: time.Now().Unix(),
+			opjwt.HeaderOBIss: t.Policy.Issuer,
+			opjwt.HeaderOBTan: t.Policy.TrustAnchor,
+		}
+		o.Crit = []string{opjwt.HeaderOBIat, opjwt.HeaderOBIss, opjwt.HeaderOBTan}
+	}
+	sig, err := opjwt.SignDetached(t.Policy.Signer, t.Policy.Alg, t.Policy.Kid, body, o)
+	if err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(req.Context())
+	out.Header.Set("x-jws-signature", sig)
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		out.ContentLength = int64(len(body))
+	}
+	return out, nil
+}
+
+func (t *JWSTransport) verify(ctx context.Context, sig string, body []byte) error {
+	// A critical header we do not check must fail the signature (RFC 7515 4.1.11), so iss and
+	// tan are only understood when configured to compare against
+	understood := []string{opjwt.HeaderOBIat}
+	if t.Policy.BankIssuer != "" {
+		understood = append(understood, opjwt.HeaderOBIss)
+	}
+	if t.Policy.TrustAnchor != "" {
+		understood = append(understood, opjwt.HeaderOBTan)
+	}
+	header, err := opjwt.VerifyDetached(sig, body, opjwt.VerifyOptions{
+		Understood: understood,
+		Key: func(kid string) (crypto.PublicKey, error) {
+			return t.Policy.Keys(ctx, kid)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if v, ok := header[opjwt.HeaderOBIat]; ok {
+		iat, isNum := v.(float64)
+		if !isNum {
+			return errors.New("iat is not a number")
+		}
+		if d := time.Since(time.Unix(int64(iat), 0)); d > jwsMaxSkew || d < -jwsMaxSkew {
+			return fmt.Errorf("iat %s is off by %s", time.Unix(int64(iat), 0).UTC().Format(time.RFC3339), d.Round(time.Second))
+		}
+	}
+	if t.Policy.BankIssuer != "" {
+		if iss, _ := header[opjwt.HeaderOBIss].(string); iss != t.Policy.BankIssuer {
+			return fmt.Errorf("iss %q, expected %q", iss, t.Policy.BankIssuer)
+		}
+	}
+	if v, ok := header[opjwt.HeaderOBTan]; ok && t.Policy.TrustAnchor != "" {
+		if tan, _ := v.(string); tan != t.Policy.TrustAnchor {
+			return fmt.Errorf("tan %q, expected %q", tan, t.Policy.TrustAnchor)
+		}
+	}
+	return nil
+}
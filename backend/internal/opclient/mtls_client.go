@@ -7,36 +7,76 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/tracing"
 )
 
-func NewMTLSClient(certPath, keyPath string) (*http.Client, error) {
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+// NewMTLSClient builds the QWAC client. getCert is asked for the QWAC on every new connection,
+// so a reloaded certificate is picked up without a restart; the returned transport is the one
+// whose idle connections must be closed then. Wrappers added around the client's transport
+// later do not forward CloseIdleConnections.
+// caBundlePath pins the server CAs; empty trusts system roots.
+func NewMTLSClient(getCert func(*tls.CertificateRequestInfo) (*tls.Certificate, error), caBundlePath string) (*http.Client, *http.Transport, error) {
+	roots, err := rootCAs(caBundlePath)
 	if err != nil {
-		return nil, fmt.Errorf("load QWAC cert/key: %w", err)
-	}
-
-	// System roots are ok for OP sandbox
-	roots, err := x509.SystemCertPool()
-	if err != nil || roots == nil {
-		roots = x509.NewCertPool()
+		return nil, nil, err
 	}
 
 	tlsCfg := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      roots,
-		MinVersion:   tls.VersionTLS12,
+		GetClientCertificate: getCert,
+		RootCAs:              roots,
+		MinVersion:           tls.VersionTLS12,
 	}
 
 	transport := &http.Transport{
 		TLSClientConfig: tlsCfg,
+		// Connections busy during a reload return to the pool with the old certificate;
+		// they are dropped at the latest after this
+		IdleConnTimeout: 90 * time.Second,
 	}
 
 	return &http.Client{
-		Transport: transport,
+		Transport: tracing.NewTransport(transport, "OP"),
 		Timeout:   15 * time.Second, // For safety; also use request context timeouts
+	}, transport, nil
+}
+
+// NewTLSClient is for OP endpoints outside mTLS, such as the JWKS: no client certificate,
+// but the same pinned CAs
+func NewTLSClient(caBundlePath string) (*http.Client, error) {
+	roots, err := rootCAs(caBundlePath)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+	}
+	return &http.Client{
+		Transport: tracing.NewTransport(transport, "OP"),
+		Timeout:   10 * time.Second,
 	}, nil
 }
 
+// rootCAs pins the server CAs to caBundlePath; empty trusts system roots
+func rootCAs(caBundlePath string) (*x509.CertPool, error) {
+	if caBundlePath == "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		return roots, nil
+	}
+	pem, err := os.ReadFile(caBundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s: no PEM certificates", caBundlePath)
+	}
+	return roots, nil
+}
+
 func FileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
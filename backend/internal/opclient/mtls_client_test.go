@@ -0,0 +1,120 @@
+package opclient_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/certs"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opclient"
+)
+
+// TestMTLSClientReload checks that after the QWAC files change the next request is made
+// on a new connection presenting the new certificate, not on a pooled one
+func TestMTLSClientReload(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].SerialNumber.String())
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "qwac.pem"), filepath.Join(dir, "qwac.key")
+	writeQWAC(t, certPath, keyPath, 1, time.Now().Add(-time.Minute))
+
+	manager := certs.NewManager()
+	qwac, err := manager.AddQWAC("test", certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, transport, err := opclient.NewMTLSClient(qwac.GetClientCertificate, caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qwac.OnReload(transport.CloseIdleConnections)
+
+	if got := presented(t, client, srv.URL); got != "1" {
+		t.Fatalf("presented serial %s, want 1", got)
+	}
+
+	// A distinct mtime, so the reload is seen even on coarse file system clocks
+	writeQWAC(t, certPath, keyPath, 2, time.Now().Add(time.Minute))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for presented(t, client, srv.URL) != "2" {
+		if time.Now().After(deadline) {
+			t.Fatal("new connections still present the old certificate after the reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// presented returns the serial of the client certificate the server saw
+func presented(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func writeQWAC(t *testing.T, certPath, keyPath string, serial int64, mtime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "qwac"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{certPath, keyPath} {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package opclient
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/metrics"
+)
+
+// ErrCircuitOpen is returned without calling OP while an endpoint's breaker is open
+var ErrCircuitOpen = errors.New("OP endpoint unavailable (circuit open)")
+
+const (
+	maxAttempts      = 3
+	baseBackoff      = 200 * time.Millisecond
+	maxBackoff       = 2 * time.Second
+	maxRetryAfter    = 5 * time.Second // longer Retry-After: give up and return OP's answer
+	breakerThreshold = 5
+	breakerCoolDown  = 30 * time.Second
+)
+
+type endpointKey struct{}
+type retrySafeKey struct{}
+
+// WithEndpoint names the OP endpoint for breakers and metrics, so URLs with ids share one
+func WithEndpoint(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, name)
+}
+
+// EndpointFromContext returns the name set by WithEndpoint, if any
+func EndpointFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(endpointKey{}).(string)
+	return name
+}
+
+// WithRetrySafe marks a non-idempotent request as safe to repeat (e.g. token requests)
+func WithRetrySafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retrySafeKey{}, true)
+}
+
+// Resilient is the policy layer around the mTLS transport: retries with jittered backoff,
+// Retry-After, and a circuit breaker per endpoint
+type Resilient struct {
+	Environment string
+	base        http.RoundTripper
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	retries  map[string]int
+}
+
+func NewResilient(environment string, base http.RoundTripper) *Resilient {
+	r := &Resilient{
+		Environment: environment,
+		base:        base,
+		breakers:    make(map[string]*breaker),
+		retries:     make(map[string]int),
+	}
+	registerResilient(r)
+	return r
+}
+
+func (r *Resilient) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := EndpointFromContext(req.Context())
+	if endpoint == "" {
+		endpoint = req.Method + " " + req.URL.Path
+	}
+	b := r.breaker(endpoint)
+	idempotent := isIdempotent(req)
+
+	for attempt := 1; ; attempt++ {
+		if !b.allow(time.Now()) {
+			return nil, ErrCircuitOpen
+		}
+
+		if attempt > 1 && req.Body != nil && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := r.base.RoundTrip(req)
+		if canceled(req, err) {
+			// Our caller gave up, which says nothing about OP either way
+			b.release()
+		} else {
+			b.record(!isOPFailure(resp, err), time.Now())
+		}
+
+		wait, retry := retryDecision(req, resp, err, idempotent, attempt)
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		r.countRetry(endpoint)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, req.Context().Err()
+		case <-t.C:
+		}
+	}
+}
+
+// isOPFailure is what counts against the breaker: OP down or overloaded, not our own 4xx
+func isOPFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
+
+func canceled(req *http.Request, err error) bool {
+	return err != nil && (errors.Is(err, context.Canceled) || errors.Is(req.Context().Err(), context.Canceled))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	safe, _ := req.Context().Value(retrySafeKey{}).(bool)
+	return safe
+}
+
+// retryDecision: idempotent calls retry on transport errors and 429/502/503/504. Other calls
+// only when OP certainly did not act on them: 429 and 503 are explicit rejections.
+func retryDecision(req *http.Request, resp *http.Response, err error, idempotent bool, attempt int) (time.Duration, bool) {
+	if attempt >= maxAttempts || req.Context().Err() != nil {
+		return 0, false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return 0, false // body cannot be replayed
+	}
+
+	if err != nil {
+		return backoff(attempt), idempotent
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		if !idempotent {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		if wait > maxRetryAfter {
+			return 0, false
+		}
+		return wait, true
+	}
+	return backoff(attempt), true
+}
+
+// backoff is "full jitter": random between 0 and the exponential cap
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return time.Duration(rand.Int64N(int64(d)) + 1)
+}
+
+// retryAfter accepts delta seconds or an HTTP date
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (r *Resilient) breaker(endpoint string) *breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[endpoint]
+	if !ok {
+		b = &breaker{threshold: breakerThreshold, coolDown: breakerCoolDown}
+		r.breakers[endpoint] = b
+	}
+	return b
+}
+
+func (r *Resilient) countRetry(endpoint string) {
+	r.mu.Lock()
+	r.retries[endpoint]++
+	r.mu.Unlock()
+}
+
+// Circuits returns the state name per endpoint seen so far, for readiness
+func (r *Resilient) Circuits() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]string, len(r.breakers))
+	for ep, b := range r.breakers {
+		out[ep] = circuitNames[b.current()]
+	}
+	return out
+}
+
+var (
+	resilientMu  sync.Mutex
+	resilientAll []*Resilient
+)
+
+// registerResilient adds r to the metrics; the collectors are registered once
+func registerResilient(r *Resilient) {
+	resilientMu.Lock()
+	defer resilientMu.Unlock()
+	resilientAll = append(resilientAll, r)
+	if len(resilientAll) > 1 {
+		return
+	}
+
+	metrics.Gauge("opl_op_circuit_state", "Circuit breaker per OP endpoint: 0 closed, 1 half-open, 2 open.", func() []metrics.Sample {
+		return collect(func(r *Resilient, ep string) float64 { return float64(r.breakers[ep].current()) })
+	})
+	metrics.Counter("opl_op_retries_total", "Retried OP requests per endpoint.", func() []metrics.Sample {
+		return collect(func(r *Resilient, ep string) float64 { return float64(r.retries[ep]) })
+	})
+}
+
+func collect(value func(r *Resilient, endpoint string) float64) []metrics.Sample {
+	resilientMu.Lock()
+	all := append([]*Resilient(nil), resilientAll...)
+	resilientMu.Unlock()
+
+	var out []metrics.Sample
+	for _, r := range all {
+		r.mu.Lock()
+		eps := make([]string, 0, len(r.breakers))
+		for ep := range r.breakers {
+			eps = append(eps, ep)
+		}
+		sort.Strings(eps)
+		for _, ep := range eps {
+			out = append(out, metrics.Sample{
+				Labels: map[string]string{"environment": r.Environment, "endpoint": ep},
+				Value:  value(r, ep),
+			})
+		}
+		r.mu.Unlock()
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package opjwt
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Protected header parameters of the UK Open Banking message signing profile
+const (
+	HeaderOBIat = "http://openbanking.org.uk/iat"
+	HeaderOBIss = "http://openbanking.org.uk/iss"
+	HeaderOBTan = "http://openbanking.org.uk/tan"
+)
+
+var ErrBadSignature = errors.New("invalid detached JWS")
+
+// DetachedOptions shape the protected header of a detached JWS
+type DetachedOptions struct {
+	// Unencoded signs the payload as is (b64=false, RFC 7797) instead of its base64url form
+	Unencoded bool
+	// Header holds extra protected parameters, e.g. the openbanking.org.uk ones
+	Header map[string]any
+	// Crit lists names in Header the receiver must understand; b64 is added when Unencoded
+	Crit []string
+}
+
+// SignDetached signs payload and returns "<header>..<signature>", the form carried in
+// x-jws-signature: the payload travels as the HTTP body, not inside the JWS
+func SignDetached(signer crypto.Signer, alg, kid string, payload []byte, o DetachedOptions) (string, error) {
+	m, ok := signerMethods[alg]
+	if !ok {
+		return "", fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	header := map[string]any{"alg": alg, "kid": kid, "typ": "JOSE"}
+	for k, v := range o.Header {
+		header[k] = v
+	}
+	crit := append([]string(nil), o.Crit...)
+	if o.Unencoded {
+		header["b64"] = false
+		crit = append([]string{"b64"}, crit...)
+	}
+	if len(crit) > 0 {
+		header["crit"] = crit
+	}
+
+	hb, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("jws header: %w", err)
+	}
+	encHeader := b64(hb)
+	sig, err := m.Sign(signingInput(encHeader, payload, o.Unencoded), signer)
+	if err != nil {
+		return "", fmt.Errorf("sign jws: %w", err)
+	}
+	return encHeader + ".." + b64(sig), nil
+}
+
+// VerifyOptions control what VerifyDetached accepts
+type VerifyOptions struct {
+	// Understood lists crit parameters the caller checks itself; b64 is always understood
+	Understood []string
+	// Key returns the public key for the header's kid
+	Key func(kid string) (crypto.PublicKey, error)
+}
+
+// VerifyDetached checks a detached JWS over payload and returns its protected header
+func VerifyDetached(jws string, payload []byte, o VerifyOptions) (map[string]any, error) {
+	encHeader, rest, ok := strings.Cut(jws, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: not compact serialization", ErrBadSignature)
+	}
+	embedded, encSig, ok := strings.Cut(rest, ".")
+	if !ok || embedded != "" {
+		return nil, fmt.Errorf("%w: payload is not detached", ErrBadSignature)
+	}
+
+	hb, err := base64.RawURLEncoding.DecodeString(encHeader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: header encoding", ErrBadSignature)
+	}
+	var header map[string]any
+	if err := json.Unmarshal(hb, &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrBadSignature, err)
+	}
+
+	// Only the asymmetric algorithms we sign with; never none or HMAC
+	alg, _ := header["alg"].(string)
+	if _, ok := signerMethods[alg]; !ok {
+		return nil, fmt.Errorf("%w: algorithm %q not accepted", ErrBadSignature, alg)
+	}
+
+	unencoded := false
+	if v, present := header["b64"]; present {
+		b, isBool := v.(bool)
+		if !isBool {
+			return nil, fmt.Errorf("%w: b64 is not a boolean", ErrBadSignature)
+		}
+		unencoded = !b
+	}
+	crit, err := critNames(header)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range crit {
+		if name != "b64" && !slices.Contains(o.Understood, name) {
+			return nil, fmt.Errorf("%w: critical header %q not understood", ErrBadSignature, name)
+		}
+		if _, present := header[name]; !present {
+			return nil, fmt.Errorf("%w: critical header %q missing", ErrBadSignature, name)
+		}
+	}
+	// RFC 7797: b64=false must be marked critical
+	if unencoded && !slices.Contains(crit, "b64") {
+		return nil, fmt.Errorf("%w: b64 not listed in crit", ErrBadSignature)
+	}
+
+	kid, _ := header["kid"].(string)
+	pub, err := o.Key(kid)
+	if err != nil {
+		return nil, fmt.Errorf("jws key %q: %w", kid, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrBadSignature)
+	}
+	if err := jwt.GetSigningMethod(alg).Verify(signingInput(encHeader, payload, unencoded), sig, pub); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	return header, nil
+}
+
+func signingInput(encHeader string, payload []byte, unencoded bool) string {
+	if unencoded {
+		return encHeader + "." + string(payload)
+	}
+	return encHeader + "." + b64(payload)
+}
+
+func critNames(header map[string]any) ([]string, error) {
+	v, present := header["crit"]
+	if !present {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%w: crit must be a non-empty list", ErrBadSignature)
+	}
+	names := make([]string, 0, len(list))
+	for _, n := range list {
+		s, ok := n.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: crit entry is not a string", ErrBadSignature)
+		}
+		names = append(names, s)
+	}
+	return names, nil
+}
@@ -0,0 +1,61 @@
+package opjwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the public part of a signing key as published in our JWKS (RFC 7517)
+type JWK struct {
+	Kty     string   `json:"kty"`
+	Kid     string   `json:"kid"`
+	Use     string   `json:"use"`
+	Alg     string   `json:"alg"`
+	N       string   `json:"n,omitempty"`
+	E       string   `json:"e,omitempty"`
+	Crv     string   `json:"crv,omitempty"`
+	X       string   `json:"x,omitempty"`
+	Y       string   `json:"y,omitempty"`
+	X5c     []string `json:"x5c,omitempty"`      // standard base64 DER, leaf first
+	X5tS256 string   `json:"x5t#S256,omitempty"` // base64url SHA-256 of the leaf DER
+}
+
+// PublicJWK describes pub; chain (may be empty) adds x5c and x5t#S256 and must start with
+// the certificate of pub
+func PublicJWK(kid, alg string, pub crypto.PublicKey, chain []*x509.Certificate) (JWK, error) {
+	k := JWK{Kid: kid, Use: "sig", Alg: alg}
+
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = b64(p.N.Bytes())
+		k.E = b64(big.NewInt(int64(p.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (p.Curve.Params().BitSize + 7) / 8
+		k.Kty = "EC"
+		k.Crv = p.Curve.Params().Name
+		k.X = b64(p.X.FillBytes(make([]byte, size)))
+		k.Y = b64(p.Y.FillBytes(make([]byte, size)))
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	for _, c := range chain {
+		k.X5c = append(k.X5c, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	if len(chain) > 0 {
+		sum := sha256.Sum256(chain[0].Raw)
+		k.X5tS256 = b64(sum[:])
+	}
+	return k, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,140 @@
+package opjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KeySet caches a bank's published signing keys and refetches on an unknown kid (rotation)
+type KeySet struct {
+	url  string
+	http *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time // last fetch attempt, successful or not
+	fetchErr error
+}
+
+func NewKeySet(url string, client *http.Client) *KeySet {
+	return &KeySet{url: url, http: client}
+}
+
+func (k *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	// Do not let a stream of bogus kids hammer the bank, nor retry a failing fetch per request
+	if time.Since(k.fetched) < 30*time.Second {
+		if k.fetchErr != nil {
+			return nil, fmt.Errorf("fetch jwks: %w", k.fetchErr)
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	k.fetched = time.Now()
+	keys, err := k.fetch(ctx)
+	k.fetchErr = err
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	k.keys = keys
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (k *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", k.url, resp.Status)
+	}
+
+	var doc struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, j := range doc.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		pub, err := j.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[j.Kid] = pub
+	}
+	return keys, nil
+}
+
+// PublicKey is the inverse of PublicJWK for RSA and EC keys
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := b64Int(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := b64Int(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
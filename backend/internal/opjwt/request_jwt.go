@@ -1,6 +1,8 @@
 package opjwt
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -23,7 +25,8 @@ type RequestClaims struct {
 	Kid          string
 }
 
-func LoadRSAPrivateKeyFromPEM(path string) (*rsa.PrivateKey, error) {
+// LoadPrivateKeyFromPEM reads an RSA or EC key (PKCS1, SEC1 or PKCS8) for file based signing
+func LoadPrivateKeyFromPEM(path string) (crypto.Signer, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read qseal key: %w", err)
@@ -38,21 +41,32 @@ func LoadRSAPrivateKeyFromPEM(path string) (*rsa.PrivateKey, error) {
 	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
 		return key, nil
 	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
 
 	// Then PKCS8
 	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("parse private key (pkcs1/pkcs8): %w", err)
+		return nil, fmt.Errorf("parse private key (pkcs1/sec1/pkcs8): %w", err)
 	}
 
-	rsaKey, ok := k.(*rsa.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("not RSA private key")
+	switch key := k.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
 	}
-	return rsaKey, nil
+	return nil, fmt.Errorf("unsupported private key type %T", k)
 }
 
-func SignOPRequestJWT(priv *rsa.PrivateKey, kid string, c RequestClaims) (string, error) {
+// SignOPRequestJWT signs with any crypto.Signer; alg is one of RS256, PS256, ES256, ES384
+func SignOPRequestJWT(signer crypto.Signer, alg, kid string, c RequestClaims) (string, error) {
+	method, err := SigningMethod(alg)
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
 
 	// OP expects claims.authorizationId inside userinfo + id_token in their examples
@@ -90,8 +104,8 @@ func SignOPRequestJWT(priv *rsa.PrivateKey, kid string, c RequestClaims) (string
 		},
 	}
 
-	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t := jwt.NewWithClaims(method, claims)
 	t.Header["typ"] = "JWT"
 	t.Header["kid"] = kid // qseal_kid
-	return t.SignedString(priv)
+	return t.SignedString(signer)
 }
@@ -0,0 +1,130 @@
+package opjwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported QSEAL algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgPS256 = "PS256"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+)
+
+// Algorithm picks the JWS alg for a signing key. configured may be empty (RSA defaults to
+// RS256, EC follows the curve) or must fit the key type.
+func Algorithm(pub crypto.PublicKey, configured string) (string, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch configured {
+		case "":
+			return AlgRS256, nil
+		case AlgRS256, AlgPS256:
+			return configured, nil
+		}
+	case *ecdsa.PublicKey:
+		var alg string
+		switch k.Curve {
+		case elliptic.P256():
+			alg = AlgES256
+		case elliptic.P384():
+			alg = AlgES384
+		default:
+			return "", fmt.Errorf("unsupported EC curve %s", k.Curve.Params().Name)
+		}
+		if configured == "" || configured == alg {
+			return alg, nil
+		}
+	default:
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+	return "", fmt.Errorf("algorithm %s does not fit a %T key", configured, pub)
+}
+
+// signerMethod is a jwt.SigningMethod backed by any crypto.Signer (file key, HSM, remote)
+type signerMethod struct {
+	alg  string
+	hash crypto.Hash
+	pss  bool
+	// EC signature half size for JWS r||s encoding, 0 for RSA
+	ecSize int
+}
+
+var signerMethods = map[string]*signerMethod{
+	AlgRS256: {alg: AlgRS256, hash: crypto.SHA256},
+	AlgPS256: {alg: AlgPS256, hash: crypto.SHA256, pss: true},
+	AlgES256: {alg: AlgES256, hash: crypto.SHA256, ecSize: 32},
+	AlgES384: {alg: AlgES384, hash: crypto.SHA384, ecSize: 48},
+}
+
+// SigningMethod returns the jwt.SigningMethod signing with a crypto.Signer for alg
+func SigningMethod(alg string) (jwt.SigningMethod, error) {
+	m, ok := signerMethods[alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	return m, nil
+}
+
+func (m *signerMethod) Alg() string { return m.alg }
+
+func (m *signerMethod) Sign(signingString string, key any) ([]byte, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: key is %T, not a crypto.Signer", m.alg, key)
+	}
+	h := m.hash.New()
+	h.Write([]byte(signingString))
+	digest := h.Sum(nil)
+
+	var opts crypto.SignerOpts = m.hash
+	if m.pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: m.hash}
+	}
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	if m.ecSize == 0 {
+		return sig, nil
+	}
+	// crypto.Signer returns ASN.1 DER for ECDSA, JWS wants fixed size r||s
+	return derToRaw(sig, m.ecSize)
+}
+
+// Verify delegates to the standard methods with the public key
+func (m *signerMethod) Verify(signingString string, sig []byte, key any) error {
+	if k, ok := key.(crypto.Signer); ok {
+		key = k.Public()
+	}
+	return jwt.GetSigningMethod(m.alg).Verify(signingString, sig, key)
+}
+
+func derToRaw(der []byte, size int) ([]byte, error) {
+	var s struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &s)
+	if err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed ECDSA signature")
+	}
+	// A remote signer or HSM may answer for another curve; FillBytes would panic
+	for _, v := range []*big.Int{s.R, s.S} {
+		if v.Sign() <= 0 || v.BitLen() > size*8 {
+			return nil, fmt.Errorf("ECDSA signature value does not fit %d bytes", size)
+		}
+	}
+	out := make([]byte, 2*size)
+	s.R.FillBytes(out[:size])
+	s.S.FillBytes(out[size:])
+	return out, nil
+}
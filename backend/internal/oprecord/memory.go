@@ -0,0 +1,74 @@
+package oprecord
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a ring buffer of the last N interactions. Lost on restart, per instance, so
+// an erasure only reaches the instance that handled it: use Postgres with several instances.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items []Interaction
+	next  int
+	full  bool
+}
+
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{items: make([]Interaction, size)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, i Interaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[s.next] = i
+	s.next = (s.next + 1) % len(s.items)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep the others in order, oldest first, as if saved again
+	start, n := 0, s.next
+	if s.full {
+		start, n = s.next, len(s.items)
+	}
+	kept := make([]Interaction, 0, n)
+	for k := 0; k < n; k++ {
+		if it := s.items[(start+k)%len(s.items)]; it.UserID != userID {
+			kept = append(kept, it)
+		}
+	}
+	clear(s.items)
+	copy(s.items, kept)
+	s.next = len(kept) % len(s.items)
+	s.full = len(kept) == len(s.items)
+	return nil
+}
+
+func (s *MemoryStore) Query(ctx context.Context, f Filter) ([]Interaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.next
+	if s.full {
+		n = len(s.items)
+	}
+	var out []Interaction
+	for k := 1; k <= n; k++ {
+		it := s.items[(s.next-k+len(s.items))%len(s.items)]
+		if !f.matches(it) {
+			continue
+		}
+		out = append(out, it)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out, nil
+}
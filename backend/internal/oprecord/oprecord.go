@@ -0,0 +1,114 @@
+// Package oprecord keeps sanitized copies of the requests we send to OP and the answers we get,
+// so a rejected call can be looked at later and replayed against the local OP simulator.
+// Recording is opt-in (OP_RECORDER); secrets and PII are masked before anything is stored.
+package oprecord
+
+import (
+	"context"
+	"time"
+)
+
+// Interaction is one OP request and its response, already sanitized
+type Interaction struct {
+	ID          string    `json:"id"` // x-fapi-interaction-id
+	Environment string    `json:"environment"`
+	Endpoint    string    `json:"endpoint"`
+	UserID      string    `json:"userId,omitempty"`
+	Request     Request   `json:"request"`
+	Response    *Response `json:"response,omitempty"` // nil when the call failed before OP answered
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"durationMs"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   string            `json:"query,omitempty"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// Filter selects interactions; zero fields match everything
+type Filter struct {
+	UserID string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// Store holds recorded interactions. Memory keeps the last N in process, Postgres shares them
+// between instances for a few days.
+type Store interface {
+	Save(ctx context.Context, i Interaction) error
+	// Query returns matching interactions, newest first
+	Query(ctx context.Context, f Filter) ([]Interaction, error)
+	// DeleteUser drops the interactions made for userID, on account erasure
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+type userKey struct{}
+
+// WithUser tags the OP calls made with ctx with the user they are made for
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+func userFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userKey{}).(string)
+	return id
+}
+
+// FixtureFile is the export format read by the local OP simulator: it answers a request
+// matching method and path with the recorded response, in recorded order.
+type FixtureFile struct {
+	Version      int       `json:"version"`
+	Interactions []Fixture `json:"interactions"`
+}
+
+type Fixture struct {
+	ID          string   `json:"id"`
+	Environment string   `json:"environment"`
+	Endpoint    string   `json:"endpoint"`
+	Request     Request  `json:"request"`
+	Response    Response `json:"response"`
+}
+
+// Fixtures converts interactions (newest first, as Query returns them) into replay order.
+// Calls OP never answered have nothing to replay and are left out.
+func Fixtures(items []Interaction) FixtureFile {
+	out := FixtureFile{Version: 1, Interactions: []Fixture{}}
+	for i := len(items) - 1; i >= 0; i-- {
+		it := items[i]
+		if it.Response == nil {
+			continue
+		}
+		out.Interactions = append(out.Interactions, Fixture{
+			ID:          it.ID,
+			Environment: it.Environment,
+			Endpoint:    it.Endpoint,
+			Request:     it.Request,
+			Response:    *it.Response,
+		})
+	}
+	return out
+}
+
+func (f Filter) matches(i Interaction) bool {
+	if f.UserID != "" && i.UserID != f.UserID {
+		return false
+	}
+	if !f.From.IsZero() && i.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !i.CreatedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package oprecord
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Recorded interactions older than this are deleted
+const postgresRetention = 7 * 24 * time.Hour
+
+// PostgresStore shares interactions between backend instances (table op_interactions).
+// Rows of a deleted user go with the user.
+type PostgresStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Save(ctx context.Context, i Interaction) error {
+	const q = `
+		INSERT INTO op_interactions
+			(interaction_id, environment, endpoint, user_id, request, response, error, duration_ms, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7, $8, $9);
+	`
+	req, err := json.Marshal(i.Request)
+	if err != nil {
+		return err
+	}
+	var resp []byte // NULL when OP never answered
+	if i.Response != nil {
+		if resp, err = json.Marshal(i.Response); err != nil {
+			return err
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, q, i.ID, i.Environment, i.Endpoint, i.UserID, req, resp, i.Error, i.DurationMs, i.CreatedAt); err != nil {
+		return err
+	}
+	s.prune(ctx)
+	return nil
+}
+
+// prune runs at most hourly per instance, piggybacking on saves
+func (s *PostgresStore) prune(ctx context.Context) {
+	s.mu.Lock()
+	due := time.Since(s.lastPrune) > time.Hour
+	if due {
+		s.lastPrune = time.Now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	const q = `DELETE FROM op_interactions WHERE created_at < $1;`
+	if _, err := s.db.ExecContext(ctx, q, time.Now().Add(-postgresRetention)); err != nil {
+		log.Println("op recorder: prune:", err)
+	}
+}
+
+// DeleteUser is done by the user_id foreign key as well; explicit for calls saved after it ran
+func (s *PostgresStore) DeleteUser(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM op_interactions WHERE user_id = $1;`, userID)
+	return err
+}
+
+func (s *PostgresStore) Query(ctx context.Context, f Filter) ([]Interaction, error) {
+	const q = `
+		SELECT interaction_id, environment, endpoint, COALESCE(user_id::text, ''),
+			request, response, error, duration_ms, created_at
+		FROM op_interactions
+		WHERE ($1 = '' OR user_id = NULLIF($1, '')::uuid)
+			AND ($2::timestamptz IS NULL OR created_at >= $2)
+			AND ($3::timestamptz IS NULL OR created_at < $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4;
+	`
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	rows, err := s.db.QueryContext(ctx, q, f.UserID, nullTime(f.From), nullTime(f.To), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Interaction
+	for rows.Next() {
+		var i Interaction
+		var req, resp []byte
+		if err := rows.Scan(&i.ID, &i.Environment, &i.Endpoint, &i.UserID, &req, &resp, &i.Error, &i.DurationMs, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(req, &i.Request); err != nil {
+			return nil, err
+		}
+		if resp != nil {
+			i.Response = &Response{}
+			if err := json.Unmarshal(resp, i.Response); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
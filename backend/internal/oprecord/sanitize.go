@@ -0,0 +1,154 @@
+package oprecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const masked = "***"
+
+// Headers that carry credentials are kept, so a replay sees they were sent, but never their value
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	"X-Jws-Signature":     true,
+}
+
+// Field names (lower case, without _ and -) whose values are masked in JSON and form bodies:
+// credentials first, then the personal data account APIs return
+var secretFields = map[string]bool{
+	"accesstoken": true, "refreshtoken": true, "idtoken": true, "token": true,
+	"clientsecret": true, "password": true, "code": true, "codeverifier": true,
+	"assertion": true, "clientassertion": true, "request": true,
+
+	"iban": true, "bban": true, "accountnumber": true, "identification": true,
+	"name": true, "ownername": true, "accountname": true, "holdername": true,
+	"debtorname": true, "creditorname": true, "debtoraccount": true, "creditoraccount": true,
+	"email": true, "phone": true, "phonenumber": true, "address": true, "postaladdress": true,
+	"ssn": true, "personalid": true, "personid": true, "birthdate": true, "dateofbirth": true,
+	"remittanceinformation": true, "message": true,
+}
+
+// Compact JWS/JWT anywhere in a value, e.g. a request object passed under an unexpected name
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`)
+
+func secretField(name string) bool {
+	n := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+	return secretFields[n]
+}
+
+func sanitizeHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		name = http.CanonicalHeaderKey(name)
+		// The recorded body is masked, so its original length would mislead a replay
+		if name == "Content-Length" {
+			continue
+		}
+		if secretHeaders[name] {
+			out[name] = masked
+			continue
+		}
+		out[name] = jwtPattern.ReplaceAllString(strings.Join(values, ", "), masked)
+	}
+	return out
+}
+
+func sanitizeQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return masked
+	}
+	return sanitizeForm(q)
+}
+
+func sanitizeForm(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := url.Values{}
+	for _, k := range keys {
+		for _, s := range v[k] {
+			if secretField(k) {
+				s = masked
+			} else {
+				s = jwtPattern.ReplaceAllString(s, masked)
+			}
+			out.Add(k, s)
+		}
+	}
+	return out.Encode()
+}
+
+// sanitizeBody masks JSON and form bodies field by field. Other content types are not stored,
+// only described, as there is no telling what they contain.
+func sanitizeBody(contentType string, body []byte, truncated bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case truncated:
+		return fmt.Sprintf("[%d+ bytes %s, too large to record]", len(body), mediaType)
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return masked
+		}
+		return sanitizeForm(form)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "" && json.Valid(body):
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Sprintf("[%d bytes invalid JSON]", len(body))
+		}
+		b, err := json.Marshal(sanitizeJSON(v))
+		if err != nil {
+			return masked
+		}
+		return string(b)
+	case mediaType == "application/jwt" || mediaType == "application/jose":
+		return masked
+	default:
+		return fmt.Sprintf("[%d bytes %s]", len(body), mediaType)
+	}
+}
+
+func sanitizeJSON(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, val := range x {
+			if secretField(k) && val != nil {
+				x[k] = masked
+			} else {
+				x[k] = sanitizeJSON(val)
+			}
+		}
+		return x
+	case []any:
+		for i := range x {
+			x[i] = sanitizeJSON(x[i])
+		}
+		return x
+	case string:
+		return jwtPattern.ReplaceAllString(x, masked)
+	default:
+		return v
+	}
+}
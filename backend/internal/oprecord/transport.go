@@ -0,0 +1,116 @@
+package oprecord
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opclient"
+)
+
+// Bodies above this size are described, not recorded
+const maxRecordedBody = 64 << 10
+
+const saveTimeout = 2 * time.Second
+
+// Transport records every request passing through it. It sits inside opclient.Resilient, so each
+// attempt of a retried call is its own interaction.
+type Transport struct {
+	Environment string
+	Base        http.RoundTripper
+	Store       Store
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// OP echoes x-fapi-interaction-id, which ties our record to their logs
+	id := req.Header.Get("x-fapi-interaction-id")
+	if id == "" {
+		id = newInteractionID()
+		req = req.Clone(req.Context())
+		req.Header.Set("x-fapi-interaction-id", id)
+	}
+
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+
+	it := Interaction{
+		ID:          id,
+		Environment: t.Environment,
+		Endpoint:    opclient.EndpointFromContext(req.Context()),
+		UserID:      userFromContext(req.Context()),
+		Request: Request{
+			Method:  req.Method,
+			Path:    req.URL.Path,
+			Query:   sanitizeQuery(req.URL.RawQuery),
+			Headers: sanitizeHeaders(req.Header),
+			Body:    sanitizeBody(req.Header.Get("Content-Type"), reqBody, len(reqBody) > maxRecordedBody),
+		},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		it.DurationMs = time.Since(start).Milliseconds()
+		it.Error = err.Error()
+		t.save(req.Context(), it)
+		return nil, err
+	}
+
+	respBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// The caller still gets the whole body, or the read error at the point it happened
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(respBody), errReader{readErr}))
+	it.DurationMs = time.Since(start).Milliseconds()
+	it.Response = &Response{
+		Status:  resp.StatusCode,
+		Headers: sanitizeHeaders(resp.Header),
+		Body:    sanitizeBody(resp.Header.Get("Content-Type"), respBody, len(respBody) > maxRecordedBody),
+	}
+	if readErr != nil {
+		it.Error = readErr.Error()
+	}
+	t.save(req.Context(), it)
+	return resp, nil
+}
+
+// save never fails the OP call; a lost record is only logged
+func (t *Transport) save(ctx context.Context, it Interaction) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+	defer cancel()
+	if err := t.Store.Save(ctx, it); err != nil {
+		log.Printf("op recorder: save %s: %v", it.ID, err)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+// newInteractionID is a random UUID (v4), the format OP expects
+func newInteractionID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,62 @@
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachChecker does a k-anonymity lookup against a local copy of the
+// Pwned Passwords range database: one file per 5 hex char SHA-1 prefix
+// (e.g. dir/21BD1.txt) with lines "SUFFIX:COUNT".
+// Only the prefix selects the file, the full hash never leaves this function.
+type BreachChecker struct {
+	Dir      string
+	MinCount int // occurrences needed to count as breached
+}
+
+func NewBreachChecker(dir string, minCount int) *BreachChecker {
+	if minCount < 1 {
+		minCount = 1
+	}
+	return &BreachChecker{Dir: dir, MinCount: minCount}
+}
+
+func (b *BreachChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := h[:5], h[5:]
+
+	f, err := os.Open(filepath.Join(b.Dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("no range file for prefix %s", prefix)
+	}
+	if err != nil {
+		return false, fmt.Errorf("open range file: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		s, count, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		if !ok || !strings.EqualFold(s, suffix) {
+			continue
+		}
+		var n int
+		if _, err := fmt.Sscan(count, &n); err != nil {
+			return false, fmt.Errorf("parse range line: %w", err)
+		}
+		return n >= b.MinCount, nil
+	}
+	return false, sc.Err()
+}
@@ -0,0 +1,119 @@
+package password
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reason is a machine-readable policy violation returned to the client.
+type Reason string
+
+const (
+	ReasonTooShort      Reason = "too_short"
+	ReasonTooLong       Reason = "too_long"
+	ReasonContainsEmail Reason = "contains_email"
+	ReasonCommon        Reason = "common_password"
+	ReasonBreached      Reason = "breached_password"
+)
+
+// PolicyError lists every rule the password failed.
+type PolicyError struct {
+	Reasons []Reason
+}
+
+func (e *PolicyError) Error() string {
+	parts := make([]string, len(e.Reasons))
+	for i, r := range e.Reasons {
+		parts[i] = string(r)
+	}
+	return "password rejected: " + strings.Join(parts, ", ")
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+type Policy struct {
+	MinLength    int
+	MaxLength    int
+	RejectEmail  bool
+	RejectCommon bool
+	Breached     *BreachChecker // nil disables the breached-password check
+
+	common map[string]struct{}
+}
+
+func NewPolicy(minLength, maxLength int, breached *BreachChecker) *Policy {
+	return &Policy{
+		MinLength:    minLength,
+		MaxLength:    maxLength,
+		RejectEmail:  true,
+		RejectCommon: true,
+		Breached:     breached,
+		common:       loadCommon(),
+	}
+}
+
+// Check returns a *PolicyError when password breaks one or more rules.
+func (p *Policy) Check(ctx context.Context, password, email string) error {
+	var reasons []Reason
+
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		reasons = append(reasons, ReasonTooShort)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		reasons = append(reasons, ReasonTooLong)
+	}
+
+	lower := strings.ToLower(password)
+	if p.RejectEmail && containsEmail(lower, email) {
+		reasons = append(reasons, ReasonContainsEmail)
+	}
+	if _, ok := p.common[lower]; p.RejectCommon && ok {
+		reasons = append(reasons, ReasonCommon)
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(ctx, password)
+		if err != nil {
+			// Missing range data should not block users, only log it
+			log.Println("breached password check:", err)
+		}
+		if breached {
+			reasons = append(reasons, ReasonBreached)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+// containsEmail rejects the full address and its local part (if long enough to matter)
+func containsEmail(lowerPassword, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(lowerPassword, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(lowerPassword, local)
+}
+
+func loadCommon() map[string]struct{} {
+	m := make(map[string]struct{})
+	sc := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			m[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return m
+}
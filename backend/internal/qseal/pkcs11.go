@@ -0,0 +1,216 @@
+//go:build pkcs11
+
+package qseal
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS11Config identifies a key on a PKCS#11 token
+type PKCS11Config struct {
+	Module     string // path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	TokenLabel string
+	PIN        string
+	KeyLabel   string
+}
+
+// pkcs11Signer signs on the token; the private key is never extractable.
+// One logged-in session is shared and serialized, signing requests are rare.
+type pkcs11Signer struct {
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	cfg     PKCS11Config
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	pub     crypto.PublicKey
+}
+
+// NewPKCS11Signer logs into the token and finds the private key by label.
+// pub is the key from the QSEAL certificate.
+func NewPKCS11Signer(cfg PKCS11Config, pub crypto.PublicKey) (crypto.Signer, error) {
+	p := pkcs11.New(cfg.Module)
+	if p == nil {
+		return nil, fmt.Errorf("load PKCS#11 module %s", cfg.Module)
+	}
+	// The module is loaded once per process; a second signer on it finds it initialized
+	if err := p.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		return nil, fmt.Errorf("initialize PKCS#11: %w", err)
+	}
+
+	s := &pkcs11Signer{ctx: p, cfg: cfg, pub: pub}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open starts a session, logs in and finds the key. The login state belongs to the token,
+// not the session: another signer on the same token may already have logged in.
+// The slot is looked up again, a restarted HSM may number its slots differently.
+func (s *pkcs11Signer) open() error {
+	slot, err := findSlot(s.ctx, s.cfg.TokenLabel)
+	if err != nil {
+		return err
+	}
+	session, err := s.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("open session: %w", err)
+	}
+	if err := s.ctx.Login(session, pkcs11.CKU_USER, s.cfg.PIN); err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		_ = s.ctx.CloseSession(session)
+		return fmt.Errorf("login: %w", err)
+	}
+	key, err := findKey(s.ctx, session, s.cfg.KeyLabel)
+	if err != nil {
+		_ = s.ctx.CloseSession(session)
+		return err
+	}
+	s.session, s.key = session, key
+	return nil
+}
+
+// sessionLost reports errors after which a new session may succeed, e.g. after an HSM restart
+func sessionLost(err error) bool {
+	return isPKCS11Error(err, pkcs11.CKR_SESSION_HANDLE_INVALID) ||
+		isPKCS11Error(err, pkcs11.CKR_SESSION_CLOSED) ||
+		isPKCS11Error(err, pkcs11.CKR_USER_NOT_LOGGED_IN) ||
+		isPKCS11Error(err, pkcs11.CKR_KEY_HANDLE_INVALID)
+}
+
+func isPKCS11Error(err error, code uint) bool {
+	return errors.Is(err, pkcs11.Error(code))
+}
+
+func findSlot(p *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := p.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("list slots: %w", err)
+	}
+	for _, s := range slots {
+		ti, err := p.GetTokenInfo(s)
+		if err == nil && ti.Label == label {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("no PKCS#11 token labelled %q", label)
+}
+
+func findKey(p *pkcs11.Ctx, session pkcs11.SessionHandle, label string) (pkcs11.ObjectHandle, error) {
+	tmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := p.FindObjectsInit(session, tmpl); err != nil {
+		return 0, fmt.Errorf("find key: %w", err)
+	}
+	objs, _, err := p.FindObjects(session, 2)
+	_ = p.FindObjectsFinal(session)
+	if err != nil {
+		return 0, fmt.Errorf("find key: %w", err)
+	}
+	switch len(objs) {
+	case 0:
+		return 0, fmt.Errorf("no private key labelled %q", label)
+	case 1:
+		return objs[0], nil
+	}
+	return 0, fmt.Errorf("several private keys labelled %q", label)
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// DigestInfo prefixes for RSASSA-PKCS1-v1_5: CKM_RSA_PKCS signs exactly what it is given
+var digestInfoPrefix = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+var pssParams = map[crypto.Hash][2]uint{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+
+	var mech *pkcs11.Mechanism
+	data := digest
+	switch {
+	case isEC(s.pub):
+		mech = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	case isPSS(opts):
+		p, ok := pssParams[hash]
+		if !ok {
+			return nil, fmt.Errorf("PSS with %s not supported", hash)
+		}
+		params := pkcs11.NewPSSParams(p[0], p[1], uint(hash.Size()))
+		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, params)
+	default:
+		prefix, ok := digestInfoPrefix[hash]
+		if !ok {
+			return nil, fmt.Errorf("PKCS#1 v1.5 with %s not supported", hash)
+		}
+		data = append(append([]byte{}, prefix...), digest...)
+		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sig, err := s.sign(mech, data)
+	if sessionLost(err) {
+		_ = s.ctx.CloseSession(s.session)
+		if err := s.open(); err != nil {
+			return nil, fmt.Errorf("reopen session: %w", err)
+		}
+		sig, err = s.sign(mech, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if isEC(s.pub) {
+		// Tokens return r||s; crypto.Signer callers expect ASN.1 DER
+		return rawToDER(sig)
+	}
+	return sig, nil
+}
+
+func (s *pkcs11Signer) sign(mech *pkcs11.Mechanism, data []byte) ([]byte, error) {
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{mech}, s.key); err != nil {
+		return nil, fmt.Errorf("sign init: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	return sig, nil
+}
+
+func isPSS(opts crypto.SignerOpts) bool {
+	_, ok := opts.(*rsa.PSSOptions)
+	return ok
+}
+
+func rawToDER(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, errors.New("malformed ECDSA signature from token")
+	}
+	half := len(raw) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(raw[:half]),
+		new(big.Int).SetBytes(raw[half:]),
+	})
+}
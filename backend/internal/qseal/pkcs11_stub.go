@@ -0,0 +1,21 @@
+//go:build !pkcs11
+
+package qseal
+
+import (
+	"crypto"
+	"errors"
+)
+
+// PKCS11Config identifies a key on a PKCS#11 token
+type PKCS11Config struct {
+	Module     string // path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	TokenLabel string
+	PIN        string
+	KeyLabel   string
+}
+
+// NewPKCS11Signer needs cgo; binaries built without the pkcs11 tag refuse such configs
+func NewPKCS11Signer(cfg PKCS11Config, pub crypto.PublicKey) (crypto.Signer, error) {
+	return nil, errors.New("PKCS#11 support not compiled in (build with -tags pkcs11)")
+}
@@ -0,0 +1,244 @@
+//go:build pkcs11
+
+package qseal
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miekg/pkcs11"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+)
+
+const (
+	testTokenLabel = "opl-test"
+	testSOPIN      = "5678"
+	testUserPIN    = "1234"
+)
+
+// TestPKCS11Signer signs through SoftHSM and verifies with the key of a certificate the token
+// signed itself. SOFTHSM2_MODULE points at libsofthsm2.so; the test is skipped without it.
+func TestPKCS11Signer(t *testing.T) {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		module = "/usr/lib/softhsm/libsofthsm2.so"
+	}
+	if _, err := os.Stat(module); err != nil {
+		t.Skipf("SoftHSM module not available: %v", err)
+	}
+
+	// A throwaway token directory, so the test never touches a configured token
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\nlog.level = ERROR\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	rsaPub, ecPub := setupToken(t, module)
+
+	cases := []struct {
+		alg      string
+		keyLabel string
+		pub      crypto.PublicKey
+	}{
+		{opjwt.AlgRS256, "rsa", rsaPub},
+		{opjwt.AlgPS256, "rsa", rsaPub},
+		{opjwt.AlgES256, "ec", ecPub},
+	}
+	for _, c := range cases {
+		t.Run(c.alg, func(t *testing.T) {
+			cfg := PKCS11Config{Module: module, TokenLabel: testTokenLabel, PIN: testUserPIN, KeyLabel: c.keyLabel}
+			signer, err := NewPKCS11Signer(cfg, c.pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert := selfSigned(t, signer)
+
+			method, err := opjwt.SigningMethod(c.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "qseal"}).SignedString(signer)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) { return cert.PublicKey, nil },
+				jwt.WithValidMethods([]string{c.alg}))
+			if err != nil {
+				t.Fatalf("verify with certificate key: %v", err)
+			}
+		})
+	}
+
+	// As after an HSM restart: the session handle is gone and the token logged out
+	t.Run("session lost", func(t *testing.T) {
+		cfg := PKCS11Config{Module: module, TokenLabel: testTokenLabel, PIN: testUserPIN, KeyLabel: "ec"}
+		signer, err := NewPKCS11Signer(cfg, ecPub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := signer.(*pkcs11Signer)
+		if err := s.ctx.CloseAllSessions(mustSlot(t, s)); err != nil {
+			t.Fatal(err)
+		}
+		selfSigned(t, signer)
+	})
+}
+
+func mustSlot(t *testing.T, s *pkcs11Signer) uint {
+	t.Helper()
+	slot, err := findSlot(s.ctx, s.cfg.TokenLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slot
+}
+
+// setupToken initializes a token with an RSA and an EC P-256 key pair and returns their
+// public keys. The module is finalized again so NewPKCS11Signer starts from scratch.
+func setupToken(t *testing.T, module string) (*rsa.PublicKey, *ecdsa.PublicKey) {
+	t.Helper()
+	p := pkcs11.New(module)
+	if p == nil {
+		t.Fatalf("load %s", module)
+	}
+	if err := p.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Finalize()
+
+	slots, err := p.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no slots: %v", err)
+	}
+	if err := p.InitToken(slots[0], testSOPIN, testTokenLabel); err != nil {
+		t.Fatalf("init token: %v", err)
+	}
+	// SoftHSM moves an initialized token to a new slot
+	slot, err := findSlot(p, testTokenLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := p.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.CloseSession(session)
+	if err := p.Login(session, pkcs11.CKU_SO, testSOPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.InitPIN(session, testUserPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Logout(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Login(session, pkcs11.CKU_USER, testUserPIN); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Logout(session)
+
+	rsaPubH := generateKeyPair(t, p, session, "rsa", pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN,
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}))
+	attrs, err := p.GetAttributeValue(session, rsaPubH, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+	}
+
+	p256, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPubH := generateKeyPair(t, p, session, "ec", pkcs11.CKM_EC_KEY_PAIR_GEN,
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, p256))
+	attrs, err = p.GetAttributeValue(session, ecPubH, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// CKA_EC_POINT is the uncompressed point wrapped in an OCTET STRING
+	var point []byte
+	if _, err := asn1.Unmarshal(attrs[0].Value, &point); err != nil {
+		t.Fatal(err)
+	}
+	ecPub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsaPub, ecPub
+}
+
+// generateKeyPair creates a token key pair labelled label with a non-extractable private key
+// and returns the public key handle
+func generateKeyPair(t *testing.T, p *pkcs11.Ctx, session pkcs11.SessionHandle, label string, mech uint, pubAttrs ...*pkcs11.Attribute) pkcs11.ObjectHandle {
+	t.Helper()
+	pubTmpl := append([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}, pubAttrs...)
+	privTmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	pub, _, err := p.GenerateKeyPair(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mech, nil)}, pubTmpl, privTmpl)
+	if err != nil {
+		t.Fatalf("generate %s key: %v", label, err)
+	}
+	return pub
+}
+
+// selfSigned has the token sign a certificate for its own key, standing in for the QSEAL certificate
+func selfSigned(t *testing.T, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "qseal test"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, signer.Public(), signer)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		t.Fatalf("certificate signature: %v", err)
+	}
+	return cert
+}
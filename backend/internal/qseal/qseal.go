@@ -0,0 +1,14 @@
+// Package qseal provides QSEAL signers for keys that do not live in a local file:
+// PKCS#11 tokens (HSMs, SoftHSM for development) and HTTP remote signers (KMS).
+// File keys are handled by certs.Cert, which reloads them on change.
+package qseal
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+)
+
+func isEC(pub crypto.PublicKey) bool {
+	_, ok := pub.(*ecdsa.PublicKey)
+	return ok
+}
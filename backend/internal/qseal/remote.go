@@ -0,0 +1,112 @@
+package qseal
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RemoteSigner asks an HTTP signing service (KMS front end) to sign digests.
+// Protocol: POST <URL> {"keyId","algorithm","digest"} -> {"signature"}, base64 (std) encoded.
+// The key never leaves the service; the public key comes from the QSEAL certificate.
+// For ECDSA the service returns an ASN.1 DER signature, as crypto.Signer does.
+type RemoteSigner struct {
+	URL   string
+	Token string // bearer token, may be empty for mTLS-only setups
+	KeyID string
+	HTTP  *http.Client
+
+	pub crypto.PublicKey
+}
+
+func NewRemoteSigner(url, token, keyID string, pub crypto.PublicKey) *RemoteSigner {
+	return &RemoteSigner{
+		URL:   url,
+		Token: token,
+		KeyID: keyID,
+		HTTP:  &http.Client{Timeout: 10 * time.Second},
+		pub:   pub,
+	}
+}
+
+func (s *RemoteSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+type remoteSignReq struct {
+	KeyID     string `json:"keyId"`
+	Algorithm string `json:"algorithm"` // scheme and hash, e.g. RSASSA-PKCS1-v1_5-SHA-256, RSASSA-PSS-SHA-256, ECDSA-SHA-256
+	Digest    string `json:"digest"`
+}
+
+type remoteSignResp struct {
+	Signature string `json:"signature"`
+}
+
+// Sign has no context in the crypto.Signer interface; the client timeout bounds it
+func (s *RemoteSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	alg, err := mechanism(s.pub, opts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(remoteSignReq{
+		KeyID:     s.KeyID,
+		Algorithm: alg,
+		Digest:    base64.StdEncoding.EncodeToString(digest),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create sign request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("remote sign: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("remote sign non-2xx: %s body=%s", resp.Status, string(b))
+	}
+	var sr remoteSignResp
+	if err := json.Unmarshal(b, &sr); err != nil {
+		return nil, fmt.Errorf("parse sign response: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(sr.Signature)
+	if err != nil || len(sig) == 0 {
+		return nil, fmt.Errorf("remote sign: invalid signature encoding")
+	}
+	return sig, nil
+}
+
+// mechanism names the signature scheme for the key type and opts
+func mechanism(pub crypto.PublicKey, opts crypto.SignerOpts) (string, error) {
+	hash := opts.HashFunc().String()
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return "RSASSA-PSS-" + hash, nil
+		}
+		return "RSASSA-PKCS1-v1_5-" + hash, nil
+	default:
+		if isEC(pub) {
+			return "ECDSA-" + hash, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported public key %T", pub)
+}
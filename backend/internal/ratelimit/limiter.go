@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Entry is the failure state stored for one key (an IP or an account).
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store is the pluggable backend holding attempt counters.
+// Memory is fine for a single instance, Postgres shares state across instances.
+type Store interface {
+	Get(ctx context.Context, key string) (Entry, error)
+	// Attempt counts an attempt as a failure in one step with the check, unless key is locked
+	// or inside its backoff delay; counted is false then. The counter restarts when the last
+	// failure is older than the policy window.
+	Attempt(ctx context.Context, key string, now time.Time, p Policy) (e Entry, counted bool, err error)
+	// Forgive takes back one counted attempt
+	Forgive(ctx context.Context, key string) error
+	// Lock blocks the key until the given time and clears its failure counter
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	FreeAttempts int           // failures allowed before backoff kicks in
+	BaseDelay    time.Duration // first backoff delay, doubled per extra failure
+	MaxDelay     time.Duration
+	Window       time.Duration // counter resets after this much quiet time
+	LockoutAfter int           // 0 disables lockout
+	LockoutFor   time.Duration
+}
+
+// LimitedError is returned when a key must wait before trying again.
+type LimitedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("too many attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Attempt returns a *LimitedError if key is locked or still inside its backoff delay, and
+// otherwise counts the attempt as failed until Succeed. Check and count are one store
+// operation, so parallel attempts cannot all pass before the first failure is recorded.
+func (l *Limiter) Attempt(ctx context.Context, key string) error {
+	now := l.now()
+	e, counted, err := l.store.Attempt(ctx, key, now, l.policy)
+	if err != nil {
+		return fmt.Errorf("count attempt: %w", err)
+	}
+	if counted {
+		return nil
+	}
+	if now.Before(e.LockedUntil) {
+		return &LimitedError{RetryAfter: e.LockedUntil.Sub(now), Locked: true}
+	}
+	wait := e.LastFailure.Add(l.policy.delay(e.Failures)).Sub(now)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return &LimitedError{RetryAfter: wait}
+}
+
+// Fail confirms a counted attempt as failed. locked is true when it triggered a lockout.
+func (l *Limiter) Fail(ctx context.Context, key string) (locked bool, until time.Time, err error) {
+	now := l.now()
+	e, err := l.store.Get(ctx, key)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("get attempts: %w", err)
+	}
+
+	if l.policy.LockoutAfter == 0 || e.Failures < l.policy.LockoutAfter || now.Before(e.LockedUntil) {
+		return false, time.Time{}, nil
+	}
+
+	until = now.Add(l.policy.LockoutFor)
+	if err := l.store.Lock(ctx, key, until); err != nil {
+		return false, time.Time{}, fmt.Errorf("lock: %w", err)
+	}
+	return true, until, nil
+}
+
+// Succeed takes back a counted attempt that turned out well, keeping earlier failures
+func (l *Limiter) Succeed(ctx context.Context, key string) error {
+	return l.store.Forgive(ctx, key)
+}
+
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, key)
+}
+
+// delay is the exponential backoff for the given failure count
+func (p Policy) delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < over && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// limited tells whether e still blocks attempts at now
+func (p Policy) limited(e Entry, now time.Time) bool {
+	if now.Before(e.LockedUntil) {
+		return true
+	}
+	if now.Sub(e.LastFailure) > p.Window {
+		return false
+	}
+	return now.Before(e.LastFailure.Add(p.delay(e.Failures)))
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in process. Only suitable for a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	maxAge  time.Duration
+}
+
+func NewMemoryStore(maxAge time.Duration) *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry), maxAge: maxAge}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) Attempt(ctx context.Context, key string, now time.Time, p Policy) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entries[key]
+	if p.limited(e, now) {
+		return e, false, nil
+	}
+	if now.Sub(e.LastFailure) > p.Window {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.LastFailure = now
+	s.entries[key] = e
+
+	s.sweep(now)
+	return e, true, nil
+}
+
+func (s *MemoryStore) Forgive(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.Failures > 0 {
+		e.Failures--
+		s.entries[key] = e
+	}
+	return nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entries[key]
+	e.Failures = 0
+	e.LockedUntil = until
+	s.entries[key] = e
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops stale entries so the map does not grow forever (caller holds mu)
+func (s *MemoryStore) sweep(now time.Time) {
+	if len(s.entries) < 10000 {
+		return
+	}
+	for k, e := range s.entries {
+		if now.Sub(e.LastFailure) > s.maxAge && now.After(e.LockedUntil) {
+			delete(s.entries, k)
+		}
+	}
+}
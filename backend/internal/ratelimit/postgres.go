@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgresStore shares counters between backend instances (table auth_throttle).
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Entry, error) {
+	const q = `
+		SELECT failures, last_failure, locked_until
+		FROM auth_throttle
+		WHERE key = $1;
+	`
+	var e Entry
+	err := s.db.QueryRowContext(ctx, q, key).Scan(&e.Failures, &e.LastFailure, &e.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, nil
+	}
+	return e, err
+}
+
+// Attempt is a single upsert: the row lock makes check and count atomic across instances.
+// The WHERE clause is Policy.limited in SQL; no row comes back when it refuses.
+func (s *PostgresStore) Attempt(ctx context.Context, key string, now time.Time, p Policy) (Entry, bool, error) {
+	const q = `
+		INSERT INTO auth_throttle (key, failures, last_failure)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN auth_throttle.last_failure < $3 THEN 1 ELSE auth_throttle.failures + 1 END,
+			last_failure = $2
+		WHERE auth_throttle.locked_until <= $2
+			AND (auth_throttle.last_failure < $3
+				OR auth_throttle.failures <= $4
+				OR auth_throttle.last_failure + make_interval(secs => LEAST($6::float8,
+					$5::float8 * power(2, LEAST(auth_throttle.failures - $4 - 1, 30)))) <= $2)
+		RETURNING failures, last_failure, locked_until;
+	`
+	var e Entry
+	err := s.db.QueryRowContext(ctx, q, key, now, now.Add(-p.Window), p.FreeAttempts,
+		p.BaseDelay.Seconds(), p.MaxDelay.Seconds()).
+		Scan(&e.Failures, &e.LastFailure, &e.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		e, err = s.Get(ctx, key)
+		return e, false, err
+	}
+	return e, err == nil, err
+}
+
+func (s *PostgresStore) Forgive(ctx context.Context, key string) error {
+	const q = `UPDATE auth_throttle SET failures = GREATEST(failures - 1, 0) WHERE key = $1;`
+	_, err := s.db.ExecContext(ctx, q, key)
+	return err
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	const q = `
+		UPDATE auth_throttle
+		SET failures = 0, locked_until = $2
+		WHERE key = $1;
+	`
+	_, err := s.db.ExecContext(ctx, q, key, until)
+	return err
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	const q = `DELETE FROM auth_throttle WHERE key = $1;`
+	_, err := s.db.ExecContext(ctx, q, key)
+	return err
+}
@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type EmailVerificationRepo struct {
+	db *sql.DB
+}
+
+func NewEmailVerificationRepo(db *sql.DB) *EmailVerificationRepo {
+	return &EmailVerificationRepo{db: db}
+}
+
+// Create stores a new token and retires the user's unused older ones
+func (r *EmailVerificationRepo) Create(ctx context.Context, tokenHash, userID, email string, expiresAt time.Time) error {
+	const q = `
+		WITH retired AS (
+			UPDATE email_verifications SET used_at = now()
+			WHERE user_id = $2 AND used_at IS NULL
+		)
+		INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+		VALUES ($1, $2, $3, $4);
+	`
+	_, err := r.db.ExecContext(ctx, q, tokenHash, userID, email, expiresAt)
+	return err
+}
+
+// Consume uses up an unexpired token and returns the user and the address it verifies.
+// Returns sql.ErrNoRows when the token is unknown, used or expired.
+func (r *EmailVerificationRepo) Consume(ctx context.Context, tokenHash string) (userID, email string, err error) {
+	const q = `
+		UPDATE email_verifications
+		SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id::text, email;
+	`
+	err = r.db.QueryRowContext(ctx, q, tokenHash).Scan(&userID, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", sql.ErrNoRows
+	}
+	return userID, email, err
+}
@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+type ExportRepo struct {
+	db *sql.DB
+}
+
+func NewExportRepo(db *sql.DB) *ExportRepo {
+	return &ExportRepo{db: db}
+}
+
+func (r *ExportRepo) Create(ctx context.Context, userID string) (model.DataExport, error) {
+	const q = `
+		INSERT INTO data_exports (user_id)
+		VALUES ($1)
+		RETURNING id::text, user_id::text, status, created_at;
+	`
+	var e model.DataExport
+	err := r.db.QueryRowContext(ctx, q, userID).Scan(&e.ID, &e.UserID, &e.Status, &e.CreatedAt)
+	return e, err
+}
+
+func (r *ExportRepo) MarkReady(ctx context.Context, id, filePath, tokenHash string, expiresAt time.Time) error {
+	const q = `
+		UPDATE data_exports
+		SET status = 'ready', file_path = $2, token_hash = $3, expires_at = $4
+		WHERE id = $1;
+	`
+	_, err := r.db.ExecContext(ctx, q, id, filePath, tokenHash, expiresAt)
+	return err
+}
+
+func (r *ExportRepo) MarkFailed(ctx context.Context, id string) error {
+	const q = `UPDATE data_exports SET status = 'failed' WHERE id = $1;`
+	_, err := r.db.ExecContext(ctx, q, id)
+	return err
+}
+
+// Get returns an export of userID; id is compared as text so malformed ids are not found
+func (r *ExportRepo) Get(ctx context.Context, id, userID string) (model.DataExport, error) {
+	const q = `
+		SELECT id::text, user_id::text, status, file_path, created_at, expires_at
+		FROM data_exports
+		WHERE id::text = $1 AND user_id = $2;
+	`
+	var e model.DataExport
+	err := r.db.QueryRowContext(ctx, q, id, userID).
+		Scan(&e.ID, &e.UserID, &e.Status, &e.FilePath, &e.CreatedAt, &e.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.DataExport{}, sql.ErrNoRows
+	}
+	return e, err
+}
+
+// ByToken finds a ready, unexpired export by its download token hash
+func (r *ExportRepo) ByToken(ctx context.Context, tokenHash string) (model.DataExport, error) {
+	const q = `
+		SELECT id::text, user_id::text, status, file_path, created_at, expires_at
+		FROM data_exports
+		WHERE token_hash = $1 AND status = 'ready' AND expires_at > now();
+	`
+	var e model.DataExport
+	err := r.db.QueryRowContext(ctx, q, tokenHash).
+		Scan(&e.ID, &e.UserID, &e.Status, &e.FilePath, &e.CreatedAt, &e.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.DataExport{}, sql.ErrNoRows
+	}
+	return e, err
+}
+
+// FilesOf returns the archive paths of a user (to remove them on account deletion)
+func (r *ExportRepo) FilesOf(ctx context.Context, userID string) ([]string, error) {
+	const q = `SELECT file_path FROM data_exports WHERE user_id = $1 AND file_path <> '';`
+	return r.paths(ctx, q, userID)
+}
+
+// DeleteExpired drops expired rows and returns their archive paths for removal
+func (r *ExportRepo) DeleteExpired(ctx context.Context) ([]string, error) {
+	const q = `DELETE FROM data_exports WHERE expires_at < now() RETURNING file_path;`
+	return r.paths(ctx, q)
+}
+
+func (r *ExportRepo) paths(ctx context.Context, q string, args ...any) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out, rows.Err()
+}
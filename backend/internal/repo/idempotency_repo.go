@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+type IdempotencyRepo struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepo(db *sql.DB) *IdempotencyRepo {
+	return &IdempotencyRepo{db: db}
+}
+
+// Reserve claims key for userID until expiresAt. A key whose record has expired, or whose
+// first request started before staleBefore and never finished, is claimed again. Otherwise
+// it returns the existing record and false.
+func (r *IdempotencyRepo) Reserve(ctx context.Context, userID, key, fingerprint string, expiresAt, staleBefore time.Time) (model.IdempotencyRecord, bool, error) {
+	// The existing record may expire and be pruned between the two queries; claim again then
+	for range 3 {
+		rec, reserved, err := r.reserve(ctx, userID, key, fingerprint, expiresAt, staleBefore)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return rec, reserved, err
+		}
+	}
+	return model.IdempotencyRecord{}, false, errors.New("idempotency key changed while being claimed")
+}
+
+func (r *IdempotencyRepo) reserve(ctx context.Context, userID, key, fingerprint string, expiresAt, staleBefore time.Time) (model.IdempotencyRecord, bool, error) {
+	const claim = `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = NULL, header = NULL, body = NULL,
+			created_at = now(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < now()
+			OR (idempotency_keys.status IS NULL AND idempotency_keys.created_at < $5)
+		RETURNING created_at;
+	`
+	var createdAt time.Time
+	err := r.db.QueryRowContext(ctx, claim, userID, key, fingerprint, expiresAt, staleBefore).Scan(&createdAt)
+	if err == nil {
+		return model.IdempotencyRecord{Fingerprint: fingerprint, ExpiresAt: expiresAt, CreatedAt: createdAt}, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return model.IdempotencyRecord{}, false, err
+	}
+
+	const existing = `
+		SELECT fingerprint, COALESCE(status, 0), header, body, expires_at, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2;
+	`
+	var rec model.IdempotencyRecord
+	var header []byte
+	err = r.db.QueryRowContext(ctx, existing, userID, key).
+		Scan(&rec.Fingerprint, &rec.Status, &header, &rec.Body, &rec.ExpiresAt, &rec.CreatedAt)
+	if err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+	if header != nil {
+		if err := json.Unmarshal(header, &rec.Header); err != nil {
+			return model.IdempotencyRecord{}, false, err
+		}
+	}
+	return rec, false, nil
+}
+
+// Complete stores the response of the reservation rec. If the key has since been claimed
+// again (the request outlived the stale limit) the newer claim is left alone.
+func (r *IdempotencyRepo) Complete(ctx context.Context, userID, key string, rec model.IdempotencyRecord, status int, header map[string][]string, body []byte) error {
+	const q = `
+		UPDATE idempotency_keys
+		SET status = $5, header = $6, body = $7
+		WHERE user_id = $1 AND key = $2 AND fingerprint = $3 AND created_at = $4 AND status IS NULL;
+	`
+	h, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, q, userID, key, rec.Fingerprint, rec.CreatedAt, status, h, body)
+	return err
+}
+
+// Release drops the reservation rec when its request ended without a response worth replaying
+func (r *IdempotencyRepo) Release(ctx context.Context, userID, key string, rec model.IdempotencyRecord) error {
+	const q = `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND fingerprint = $3 AND created_at = $4 AND status IS NULL;
+	`
+	_, err := r.db.ExecContext(ctx, q, userID, key, rec.Fingerprint, rec.CreatedAt)
+	return err
+}
+
+func (r *IdempotencyRepo) DeleteExpired(ctx context.Context) error {
+	const q = `DELETE FROM idempotency_keys WHERE expires_at < now();`
+	_, err := r.db.ExecContext(ctx, q)
+	return err
+}
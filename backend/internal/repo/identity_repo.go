@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+type IdentityRepo struct {
+	db *sql.DB
+}
+
+func NewIdentityRepo(db *sql.DB) *IdentityRepo {
+	return &IdentityRepo{db: db}
+}
+
+func (r *IdentityRepo) Link(ctx context.Context, userID, provider, subject, email string) error {
+	const q = `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4);
+	`
+	_, err := r.db.ExecContext(ctx, q, userID, provider, subject, email)
+	return err
+}
+
+// FindUser returns the user linked to provider+subject or sql.ErrNoRows
+func (r *IdentityRepo) FindUser(ctx context.Context, provider, subject string) (string, error) {
+	const q = `
+		SELECT user_id::text
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2;
+	`
+	var userID string
+	err := r.db.QueryRowContext(ctx, q, provider, subject).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", sql.ErrNoRows
+	}
+	return userID, err
+}
+
+func (r *IdentityRepo) ListByUser(ctx context.Context, userID string) ([]model.Identity, error) {
+	const q = `
+		SELECT provider, subject, email, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.Identity
+	for rows.Next() {
+		var i model.Identity
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Email, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+func (r *IdentityRepo) Unlink(ctx context.Context, userID, provider string) error {
+	const q = `
+		DELETE FROM user_identities
+		WHERE user_id = $1 AND provider = $2;
+	`
+	res, err := r.db.ExecContext(ctx, q, userID, provider)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// OIDCState is the pending login/link attempt stored between start and callback
+type OIDCState struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	LinkUserID   string // set when an existing user links a provider
+}
+
+func (r *IdentityRepo) SaveState(ctx context.Context, state string, s OIDCState, expiresAt time.Time) error {
+	const q = `
+		INSERT INTO oidc_states (state, provider, code_verifier, nonce, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6);
+	`
+	_, err := r.db.ExecContext(ctx, q, state, s.Provider, s.CodeVerifier, s.Nonce, s.LinkUserID, expiresAt)
+	return err
+}
+
+// TakeState deletes and returns an unexpired state (single use), or sql.ErrNoRows
+func (r *IdentityRepo) TakeState(ctx context.Context, state string) (OIDCState, error) {
+	const q = `
+		DELETE FROM oidc_states
+		WHERE state = $1 AND expires_at > now()
+		RETURNING provider, code_verifier, nonce, COALESCE(link_user_id::text, '');
+	`
+	var s OIDCState
+	err := r.db.QueryRowContext(ctx, q, state).Scan(&s.Provider, &s.CodeVerifier, &s.Nonce, &s.LinkUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return OIDCState{}, sql.ErrNoRows
+	}
+	return s, err
+}
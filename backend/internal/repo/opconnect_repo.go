@@ -3,6 +3,8 @@ package repo
 import (
 	"context"
 	"database/sql"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
 )
 
 type OPConnectRepo struct {
@@ -13,11 +15,50 @@ func NewOPConnectRepo(db *sql.DB) *OPConnectRepo {
 	return &OPConnectRepo{db: db}
 }
 
-func (r *OPConnectRepo) SavePending(ctx context.Context, state, userID, authorizationID, nonce string) error {
+func (r *OPConnectRepo) SavePending(ctx context.Context, state, userID, authorizationID, nonce, environment string) error {
 	const q = `
-		INSERT INTO op_authorizations (state, user_id, authorization_id, nonce)
-		VALUES ($1, $2, $3, $4);
+		INSERT INTO op_authorizations (state, user_id, authorization_id, nonce, environment)
+		VALUES ($1, $2, $3, $4, $5);
 	`
-	_, err := r.db.ExecContext(ctx, q, state, userID, authorizationID, nonce)
+	_, err := r.db.ExecContext(ctx, q, state, userID, authorizationID, nonce, environment)
 	return err
 }
+
+func (r *OPConnectRepo) ListByUser(ctx context.Context, userID string) ([]model.Connection, error) {
+	const q = `
+		SELECT authorization_id, environment, status, created_at, updated_at
+		FROM op_authorizations
+		WHERE user_id = $1
+		ORDER BY created_at DESC;
+	`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.Connection
+	for rows.Next() {
+		var c model.Connection
+		if err := rows.Scan(&c.AuthorizationID, &c.Environment, &c.Status, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// RequireReconsent flags every connection of the user so the next sync asks for a new consent.
+// Returns the number of connections flagged.
+func (r *OPConnectRepo) RequireReconsent(ctx context.Context, userID string) (int64, error) {
+	const q = `
+		UPDATE op_authorizations
+		SET status = $2, updated_at = now()
+		WHERE user_id = $1 AND status <> $2;
+	`
+	res, err := r.db.ExecContext(ctx, q, userID, model.ConnectionReconsentRequired)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PasswordResetRepo struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepo(db *sql.DB) *PasswordResetRepo {
+	return &PasswordResetRepo{db: db}
+}
+
+// Create stores only the hash of the reset token
+func (r *PasswordResetRepo) Create(ctx context.Context, tokenHash, userID string, expiresAt time.Time) error {
+	const q = `
+		INSERT INTO password_resets (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3);
+	`
+	_, err := r.db.ExecContext(ctx, q, tokenHash, userID, expiresAt)
+	return err
+}
+
+// Lookup returns the user id of an unused, unexpired token without using it up
+func (r *PasswordResetRepo) Lookup(ctx context.Context, tokenHash string) (string, error) {
+	const q = `
+		SELECT user_id::text
+		FROM password_resets
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now();
+	`
+	var userID string
+	err := r.db.QueryRowContext(ctx, q, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", sql.ErrNoRows
+	}
+	return userID, err
+}
+
+// Consume marks an unused, unexpired token as used and returns its user id.
+// Returns sql.ErrNoRows when the token is unknown, used or expired.
+func (r *PasswordResetRepo) Consume(ctx context.Context, tokenHash string) (string, error) {
+	const q = `
+		UPDATE password_resets
+		SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id::text;
+	`
+	var userID string
+	err := r.db.QueryRowContext(ctx, q, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", sql.ErrNoRows
+	}
+	return userID, err
+}
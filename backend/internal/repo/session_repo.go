@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+type SessionRepo struct {
+	db *sql.DB
+}
+
+func NewSessionRepo(db *sql.DB) *SessionRepo {
+	return &SessionRepo{db: db}
+}
+
+func (r *SessionRepo) Create(ctx context.Context, userID, refreshHash, ip, userAgent, mfaLevel string, expiresAt time.Time) (string, error) {
+	const q = `
+		INSERT INTO sessions (user_id, refresh_token_hash, ip, user_agent, mfa_level, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id::text;
+	`
+	var id string
+	err := r.db.QueryRowContext(ctx, q, userID, refreshHash, ip, userAgent, mfaLevel, expiresAt).Scan(&id)
+	return id, err
+}
+
+// Rotate swaps the refresh token of an active session and returns the session and user ids.
+// Returns sql.ErrNoRows when the token is unknown, revoked or expired.
+func (r *SessionRepo) Rotate(ctx context.Context, oldHash, newHash, ip, userAgent string) (sessionID, userID string, err error) {
+	const q = `
+		UPDATE sessions
+		SET refresh_token_hash = $2, ip = $3, user_agent = $4, last_seen_at = now()
+		WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > now()
+		RETURNING id::text, user_id::text;
+	`
+	err = r.db.QueryRowContext(ctx, q, oldHash, newHash, ip, userAgent).Scan(&sessionID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", sql.ErrNoRows
+	}
+	return sessionID, userID, err
+}
+
+// RevokeByRefresh revokes the session holding refreshHash and returns its session and user
+// ids. Returns sql.ErrNoRows when no active session holds it.
+func (r *SessionRepo) RevokeByRefresh(ctx context.Context, refreshHash string) (sessionID, userID string, err error) {
+	const q = `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE refresh_token_hash = $1 AND revoked_at IS NULL
+		RETURNING id::text, user_id::text;
+	`
+	err = r.db.QueryRowContext(ctx, q, refreshHash).Scan(&sessionID, &userID)
+	return sessionID, userID, err
+}
+
+// Active reports whether the session exists, belongs to an enabled userID and is not revoked or expired.
+// last_seen_at is refreshed at most once a minute to keep this a read on most requests.
+func (r *SessionRepo) Active(ctx context.Context, sessionID, userID string) (bool, error) {
+	const q = `
+		SELECT s.last_seen_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL AND s.expires_at > now()
+			AND u.disabled_at IS NULL;
+	`
+	var lastSeen time.Time
+	err := r.db.QueryRowContext(ctx, q, sessionID, userID).Scan(&lastSeen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if time.Since(lastSeen) > time.Minute {
+		const touch = `UPDATE sessions SET last_seen_at = now() WHERE id = $1;`
+		if _, err := r.db.ExecContext(ctx, touch, sessionID); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// SignedInAt returns when the active session sessionID of userID was created, which is when
+// the user last proved who they are in it; refreshes keep the time
+func (r *SessionRepo) SignedInAt(ctx context.Context, sessionID, userID string) (time.Time, error) {
+	const q = `
+		SELECT created_at FROM sessions
+		WHERE id::text = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now();
+	`
+	var t time.Time
+	err := r.db.QueryRowContext(ctx, q, sessionID, userID).Scan(&t)
+	return t, err
+}
+
+func (r *SessionRepo) ListActive(ctx context.Context, userID string) ([]model.Session, error) {
+	const q = `
+		SELECT id::text, user_id::text, ip, user_agent, mfa_level, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY last_seen_at DESC;
+	`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.Session
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.MFALevel, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// Revoke returns sql.ErrNoRows when the session is not an active session of userID.
+// id is compared as text so malformed ids from the URL are simply not found.
+func (r *SessionRepo) Revoke(ctx context.Context, sessionID, userID string) error {
+	const q = `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE id::text = $1 AND user_id = $2 AND revoked_at IS NULL;
+	`
+	res, err := r.db.ExecContext(ctx, q, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *SessionRepo) RevokeAll(ctx context.Context, userID string) error {
+	const q = `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`
+	_, err := r.db.ExecContext(ctx, q, userID)
+	return err
+}
+
+// RevokeOthers revokes every session of userID but keepID
+func (r *SessionRepo) RevokeOthers(ctx context.Context, userID, keepID string) error {
+	const q = `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE user_id = $1 AND id::text <> $2 AND revoked_at IS NULL;
+	`
+	_, err := r.db.ExecContext(ctx, q, userID, keepID)
+	return err
+}
+
+// ListAll includes revoked and expired sessions (data export)
+func (r *SessionRepo) ListAll(ctx context.Context, userID string) ([]model.Session, error) {
+	const q = `
+		SELECT id::text, user_id::text, ip, user_agent, mfa_level, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY created_at DESC;
+	`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.Session
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.MFALevel, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+type SignInEventRepo struct {
+	db *sql.DB
+}
+
+func NewSignInEventRepo(db *sql.DB) *SignInEventRepo {
+	return &SignInEventRepo{db: db}
+}
+
+// Record stores a sign-in attempt. userID is empty for unknown emails.
+func (r *SignInEventRepo) Record(ctx context.Context, userID, email, ip, userAgent string, success bool, reason string) error {
+	const q = `
+		INSERT INTO sign_in_events (user_id, email, ip, user_agent, success, reason)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6);
+	`
+	_, err := r.db.ExecContext(ctx, q, userID, email, ip, userAgent, success, reason)
+	return err
+}
+
+func (r *SignInEventRepo) ListByUser(ctx context.Context, userID string, limit int) ([]model.SignInEvent, error) {
+	const q = `
+		SELECT id, user_id::text, email, ip, user_agent, success, reason, created_at
+		FROM sign_in_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2;
+	`
+	rows, err := r.db.QueryContext(ctx, q, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.SignInEvent
+	for rows.Next() {
+		var e model.SignInEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Email, &e.IP, &e.UserAgent, &e.Success, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
 )
 
+// ErrLastAdmin refuses a role change that would leave no enabled admin
+var ErrLastAdmin = errors.New("the last admin cannot be demoted")
+
 type UserRepo struct {
 	db *sql.DB
 }
@@ -16,32 +21,233 @@ func NewUserRepo(db *sql.DB) *UserRepo {
 	return &UserRepo{db: db}
 }
 
+const userColumns = `id::text, email, email_verified, password_hash, display_name, locale, preferred_currency, timezone, role, disabled_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (model.User, error) {
+	var u model.User
+	err := row.Scan(&u.ID, &u.Email, &u.EmailVerified, &u.PasswordHash,
+		&u.DisplayName, &u.Locale, &u.PreferredCurrency, &u.Timezone, &u.Role, &u.DisabledAt, &u.CreatedAt)
+	return u, err
+}
+
 func (r *UserRepo) CreateUser(ctx context.Context, email, passwordHash string) (model.User, error) {
 	const q = `
 		INSERT INTO users (email, password_hash)
 		VALUES ($1, $2)
-		RETURNING id::text, email, password_hash, created_at;
+		RETURNING ` + userColumns + `;
 	`
 
-	var u model.User
-	err := r.db.QueryRowContext(ctx, q, email, passwordHash).
-		Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt)
-	return u, err
+	return scanUser(r.db.QueryRowContext(ctx, q, email, passwordHash))
+}
+
+// CreateExternalUser creates a user that signs in through an identity provider only.
+// The empty password hash never matches in bcrypt, so password login is impossible.
+func (r *UserRepo) CreateExternalUser(ctx context.Context, email string, emailVerified bool, displayName string) (model.User, error) {
+	const q = `
+		INSERT INTO users (email, password_hash, email_verified, display_name)
+		VALUES ($1, '', $2, $3)
+		RETURNING ` + userColumns + `;
+	`
+
+	return scanUser(r.db.QueryRowContext(ctx, q, email, emailVerified, displayName))
 }
 
 func (r *UserRepo) GetByEmail(ctx context.Context, email string) (model.User, error) {
 	const q = `
-		SELECT id::text, email, password_hash, created_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = $1;
 	`
 
-	var u model.User
-	err := r.db.QueryRowContext(ctx, q, email).
-		Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	u, err := scanUser(r.db.QueryRowContext(ctx, q, email))
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return model.User{}, sql.ErrNoRows
 	}
 	return u, err
 }
+
+func (r *UserRepo) GetByID(ctx context.Context, id string) (model.User, error) {
+	const q = `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1;
+	`
+
+	u, err := scanUser(r.db.QueryRowContext(ctx, q, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, sql.ErrNoRows
+	}
+	return u, err
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	const q = `
+		UPDATE users
+		SET password_hash = $2
+		WHERE id = $1;
+	`
+	_, err := r.db.ExecContext(ctx, q, id, passwordHash)
+	return err
+}
+
+// UpdateProfile only touches the fields that are set in upd
+func (r *UserRepo) UpdateProfile(ctx context.Context, id string, upd model.ProfileUpdate) (model.User, error) {
+	const q = `
+		UPDATE users SET
+			display_name       = COALESCE($2, display_name),
+			locale             = COALESCE($3, locale),
+			preferred_currency = COALESCE($4, preferred_currency),
+			timezone           = COALESCE($5, timezone)
+		WHERE id = $1
+		RETURNING ` + userColumns + `;
+	`
+
+	return scanUser(r.db.QueryRowContext(ctx, q, id, upd.DisplayName, upd.Locale, upd.PreferredCurrency, upd.Timezone))
+}
+
+// SetVerifiedEmail stores a (possibly new) address as verified.
+// Fails with a unique violation if someone registered the address meanwhile.
+func (r *UserRepo) SetVerifiedEmail(ctx context.Context, id, email string) error {
+	const q = `
+		UPDATE users
+		SET email = $2, email_verified = true
+		WHERE id = $1;
+	`
+	_, err := r.db.ExecContext(ctx, q, id, email)
+	return err
+}
+
+// likeEscaper makes a search query match literally inside ILIKE, whose escape character is \
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search matches email substrings, newest users first
+func (r *UserRepo) Search(ctx context.Context, query string, limit int) ([]model.User, error) {
+	const q = `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE email ILIKE '%' || $1 || '%'
+		ORDER BY created_at DESC
+		LIMIT $2;
+	`
+	rows, err := r.db.QueryContext(ctx, q, likeEscaper.Replace(query), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// SetDisabled disables (true) or re-enables (false) an account
+func (r *UserRepo) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	const q = `
+		UPDATE users
+		SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) ELSE NULL END
+		WHERE id = $1;
+	`
+	res, err := r.db.ExecContext(ctx, q, id, disabled)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetRole changes the role of a user and returns the previous one. Demoting the last enabled
+// admin fails with ErrLastAdmin; the admin rows are locked so two demotions cannot both pass.
+func (r *UserRepo) SetRole(ctx context.Context, id, role string) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	const lock = `
+		SELECT id::text, role, disabled_at IS NULL
+		FROM users
+		WHERE id = $1 OR role = $2
+		FOR UPDATE;
+	`
+	rows, err := tx.QueryContext(ctx, lock, id, model.RoleAdmin)
+	if err != nil {
+		return "", err
+	}
+	previous, found, admins := "", false, 0
+	for rows.Next() {
+		var rowID, rowRole string
+		var enabled bool
+		if err := rows.Scan(&rowID, &rowRole, &enabled); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if rowID == id {
+			previous, found = rowRole, true
+		}
+		if rowRole == model.RoleAdmin && enabled {
+			admins++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if !found {
+		return "", sql.ErrNoRows
+	}
+	if previous == model.RoleAdmin && role != model.RoleAdmin && admins <= 1 {
+		return "", ErrLastAdmin
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET role = $2 WHERE id = $1;`, id, role); err != nil {
+		return "", err
+	}
+	return previous, tx.Commit()
+}
+
+// DeleteAccount removes every personal row of the user in one transaction.
+// audit_log is kept: it only holds the (now dangling) user id, which the law requires us to retain.
+func (r *UserRepo) DeleteAccount(ctx context.Context, id, email string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []struct {
+		q    string
+		args []any
+	}{
+		{`DELETE FROM sessions WHERE user_id = $1;`, []any{id}},
+		{`DELETE FROM sign_in_events WHERE user_id = $1 OR lower(email) = lower($2);`, []any{id, email}},
+		{`DELETE FROM password_resets WHERE user_id = $1;`, []any{id}},
+		{`DELETE FROM email_verifications WHERE user_id = $1;`, []any{id}},
+		{`DELETE FROM user_identities WHERE user_id = $1;`, []any{id}},
+		{`DELETE FROM oidc_states WHERE link_user_id = $1;`, []any{id}},
+		{`DELETE FROM op_authorizations WHERE user_id = $1;`, []any{id}},
+		{`DELETE FROM data_exports WHERE user_id = $1;`, []any{id}},
+		{`DELETE FROM auth_throttle WHERE key = 'login-account:' || lower($1);`, []any{email}},
+		{`DELETE FROM users WHERE id = $1;`, []any{id}},
+	}
+	for _, st := range stmts {
+		if _, err := tx.ExecContext(ctx, st.q, st.args...); err != nil {
+			return fmt.Errorf("%s: %w", st.q, err)
+		}
+	}
+	return tx.Commit()
+}
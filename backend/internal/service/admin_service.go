@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oprecord"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
+)
+
+var (
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrOwnRole          = errors.New("admins cannot demote themselves")
+	ErrLastAdmin        = repo.ErrLastAdmin
+	ErrRecorderDisabled = errors.New("OP recording is disabled")
+)
+
+// UserOverview is what support staff see about a user: no transaction details
+type UserOverview struct {
+	User           model.User         `json:"user"`
+	Connections    []model.Connection `json:"connections"`
+	ActiveSessions int                `json:"activeSessions"`
+}
+
+// AdminService backs the admin API. Every method writes an audit event for the acting admin.
+type AdminService struct {
+	users    *repo.UserRepo
+	sessions *repo.SessionRepo
+	opRepo   *repo.OPConnectRepo
+	audit    *audit.Recorder
+	opCalls  oprecord.Store // nil unless OP_RECORDER is on
+}
+
+func NewAdminService(users *repo.UserRepo, sessions *repo.SessionRepo, opRepo *repo.OPConnectRepo, recorder *audit.Recorder, opCalls oprecord.Store) *AdminService {
+	return &AdminService{
+		users:    users,
+		sessions: sessions,
+		opRepo:   opRepo,
+		audit:    recorder,
+		opCalls:  opCalls,
+	}
+}
+
+// Actor identifies the admin performing an action
+type Actor struct {
+	UserID string
+}
+
+func (s *AdminService) SearchUsers(ctx context.Context, actor Actor, query string, limit int) ([]model.User, error) {
+	// The query is usually (part of) an email, which the audit log must not hold
+	if err := s.record(ctx, actor, "admin.user.search", "", map[string]any{"queryLength": len(query)}); err != nil {
+		return nil, err
+	}
+	return s.users.Search(ctx, query, limit)
+}
+
+func (s *AdminService) UserOverview(ctx context.Context, actor Actor, userID string) (UserOverview, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return UserOverview{}, err
+	}
+	if err := s.record(ctx, actor, "admin.user.view", userID, nil); err != nil {
+		return UserOverview{}, err
+	}
+
+	conns, err := s.opRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return UserOverview{}, err
+	}
+	sessions, err := s.sessions.ListActive(ctx, userID)
+	if err != nil {
+		return UserOverview{}, err
+	}
+	return UserOverview{User: u, Connections: conns, ActiveSessions: len(sessions)}, nil
+}
+
+// SetDisabled disables or re-enables an account. Disabling also ends all its sessions.
+func (s *AdminService) SetDisabled(ctx context.Context, actor Actor, userID string, disabled bool) error {
+	if err := s.users.SetDisabled(ctx, userID, disabled); err != nil {
+		return err
+	}
+	if disabled {
+		if err := s.sessions.RevokeAll(ctx, userID); err != nil {
+			return fmt.Errorf("revoke sessions: %w", err)
+		}
+	}
+
+	action := "admin.user.enable"
+	if disabled {
+		action = "admin.user.disable"
+	}
+	return s.record(ctx, actor, action, userID, nil)
+}
+
+// SetRole changes a user's role. The role travels in access tokens, so a change ends the
+// user's sessions. The last admin and the acting admin cannot be demoted.
+func (s *AdminService) SetRole(ctx context.Context, actor Actor, userID, role string) error {
+	if !model.ValidRole(role) {
+		return ErrInvalidRole
+	}
+	if userID == actor.UserID && role != model.RoleAdmin {
+		return ErrOwnRole
+	}
+	previous, err := s.users.SetRole(ctx, userID, role)
+	if err != nil {
+		return err
+	}
+	if previous != role {
+		if err := s.sessions.RevokeAll(ctx, userID); err != nil {
+			return fmt.Errorf("revoke sessions: %w", err)
+		}
+	}
+	return s.record(ctx, actor, "admin.user.role", userID, map[string]any{"role": role})
+}
+
+// ForceReconsent flags all bank connections of the user as needing a new consent
+func (s *AdminService) ForceReconsent(ctx context.Context, actor Actor, userID string) (int64, error) {
+	n, err := s.opRepo.RequireReconsent(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return n, s.record(ctx, actor, "admin.connection.reconsent", userID, map[string]any{"connections": n})
+}
+
+// OPInteractions lists recorded OP calls, newest first. Bodies are already sanitized, but
+// viewing them is still audited like any look at user data.
+func (s *AdminService) OPInteractions(ctx context.Context, actor Actor, f oprecord.Filter) ([]oprecord.Interaction, error) {
+	if s.opCalls == nil {
+		return nil, ErrRecorderDisabled
+	}
+	if err := s.record(ctx, actor, "admin.op_interactions.view", f.UserID, filterDetails(f)); err != nil {
+		return nil, err
+	}
+	return s.opCalls.Query(ctx, f)
+}
+
+// ExportOPFixtures returns recorded OP calls in the format the local OP simulator replays
+func (s *AdminService) ExportOPFixtures(ctx context.Context, actor Actor, f oprecord.Filter) (oprecord.FixtureFile, error) {
+	if s.opCalls == nil {
+		return oprecord.FixtureFile{}, ErrRecorderDisabled
+	}
+	if err := s.record(ctx, actor, "admin.op_interactions.export", f.UserID, filterDetails(f)); err != nil {
+		return oprecord.FixtureFile{}, err
+	}
+	items, err := s.opCalls.Query(ctx, f)
+	if err != nil {
+		return oprecord.FixtureFile{}, err
+	}
+	return oprecord.Fixtures(items), nil
+}
+
+func filterDetails(f oprecord.Filter) map[string]any {
+	d := map[string]any{"limit": f.Limit}
+	if !f.From.IsZero() {
+		d["from"] = f.From
+	}
+	if !f.To.IsZero() {
+		d["to"] = f.To
+	}
+	return d
+}
+
+func (s *AdminService) record(ctx context.Context, actor Actor, action, target string, details map[string]any) error {
+	err := s.audit.Record(ctx, audit.Event{
+		ActorID:      actor.UserID,
+		Action:       action,
+		TargetUserID: target,
+		Details:      details,
+	})
+	if err != nil {
+		return fmt.Errorf("audit %s: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+)
+
+// recordAudit is used for events where losing the audit row is preferable to failing
+// the user's request (sign-ins, profile changes). Consent and admin actions fail instead.
+func recordAudit(ctx context.Context, rec *audit.Recorder, e audit.Event) {
+	if err := rec.Record(ctx, e); err != nil {
+		log.Printf("audit %s: %v", e.Action, err)
+	}
+}
@@ -4,51 +4,191 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/notify"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/password"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/ratelimit"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
 )
 
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountDisabled    = errors.New("account disabled")
+)
+
+// Brute-force policies: per IP backoff, per account backoff + temporary lockout
+var (
+	loginIPPolicy = ratelimit.Policy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+	loginAccountPolicy = ratelimit.Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		Window:       15 * time.Minute,
+		LockoutAfter: 10,
+		LockoutFor:   15 * time.Minute,
+	}
+	signupIPPolicy = ratelimit.Policy{
+		FreeAttempts: 5,
+		BaseDelay:    10 * time.Second,
+		MaxDelay:     10 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
 type AuthService struct {
 	users     *repo.UserRepo
+	resets    *repo.PasswordResetRepo
+	sessions  *repo.SessionRepo
+	signIns   *repo.SignInEventRepo
+	audit     *audit.Recorder
 	jwtSecret []byte
+	notifier  notify.Notifier
+	policy    *password.Policy
+
+	loginIP      *ratelimit.Limiter
+	loginAccount *ratelimit.Limiter
+	signupIP     *ratelimit.Limiter
+	resetIP      *ratelimit.Limiter
+
+	// Compared against for unknown emails so they take as long as wrong passwords
+	dummyHash []byte
 }
 
-func NewAuthService(users *repo.UserRepo, jwtSecret string) *AuthService {
-	return &AuthService{
-		users:     users,
-		jwtSecret: []byte(jwtSecret),
+func NewAuthService(
+	users *repo.UserRepo,
+	resets *repo.PasswordResetRepo,
+	sessions *repo.SessionRepo,
+	signIns *repo.SignInEventRepo,
+	recorder *audit.Recorder,
+	jwtSecret string,
+	throttle ratelimit.Store,
+	notifier notify.Notifier,
+	policy *password.Policy,
+) (*AuthService, error) {
+	dummy, err := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("dummy hash: %w", err)
 	}
+	return &AuthService{
+		users:        users,
+		resets:       resets,
+		sessions:     sessions,
+		signIns:      signIns,
+		audit:        recorder,
+		jwtSecret:    []byte(jwtSecret),
+		notifier:     notifier,
+		policy:       policy,
+		loginIP:      ratelimit.NewLimiter(throttle, loginIPPolicy),
+		loginAccount: ratelimit.NewLimiter(throttle, loginAccountPolicy),
+		signupIP:     ratelimit.NewLimiter(throttle, signupIPPolicy),
+		resetIP:      ratelimit.NewLimiter(throttle, signupIPPolicy),
+		dummyHash:    dummy,
+	}, nil
 }
 
-func (s *AuthService) Signup(ctx context.Context, email, password string) (model.User, error) {
-	// TODO: more validation
+func (s *AuthService) Signup(ctx context.Context, email, password, clientIP string) (model.User, error) {
+	// Every signup counts as an attempt, successful or not
+	ipKey := "signup-ip:" + clientIP
+	if err := s.signupIP.Attempt(ctx, ipKey); err != nil {
+		return model.User{}, err
+	}
+
+	if err := s.policy.Check(ctx, password, email); err != nil {
+		return model.User{}, err
+	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return model.User{}, err
 	}
-	return s.users.CreateUser(ctx, email, string(hash))
+	u, err := s.users.CreateUser(ctx, email, string(hash))
+	if err != nil {
+		return model.User{}, err
+	}
+
+	recordAudit(ctx, s.audit, audit.Event{ActorID: u.ID, Action: "auth.signup", TargetUserID: u.ID})
+	return u, nil
+}
+
+// ClientInfo describes where a request came from, stored on sessions and sign-in events
+type ClientInfo struct {
+	IP        string
+	UserAgent string
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, error) {
+func (s *AuthService) Login(ctx context.Context, email, password string, client ClientInfo) (Tokens, error) {
+	ipKey := "login-ip:" + client.IP
+	accountKey := "login-account:" + normalizeEmail(email)
+
+	// Each attempt counts as failed until the password matched
+	if err := s.loginIP.Attempt(ctx, ipKey); err != nil {
+		s.recordSignIn(ctx, "", email, client, false, "throttled")
+		return Tokens{}, err
+	}
+	if err := s.loginAccount.Attempt(ctx, accountKey); err != nil {
+		s.recordSignIn(ctx, "", email, client, false, "throttled")
+		return Tokens{}, err
+	}
+
 	// TODO: more validation 
 	u, err := s.users.GetByEmail(ctx, email)
+	if err != nil && !IsNoRows(err) {
+		return Tokens{}, err
+	}
+
+	// Unknown emails still pay for a bcrypt compare (no timing based enumeration)
+	hash := []byte(u.PasswordHash)
 	if err != nil {
-		return "", err
+		hash = s.dummyHash
+	}
+	if cmpErr := bcrypt.CompareHashAndPassword(hash, []byte(password)); cmpErr != nil || err != nil {
+		s.loginFailed(ctx, ipKey, accountKey, u)
+		s.recordSignIn(ctx, u.ID, email, client, false, "invalid_credentials")
+		return Tokens{}, ErrInvalidCredentials
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+	// Earlier IP failures are kept on success: one valid account must not unlock guessing others
+	if err := s.loginIP.Succeed(ctx, ipKey); err != nil {
+		return Tokens{}, err
+	}
+	if err := s.loginAccount.Reset(ctx, accountKey); err != nil {
+		return Tokens{}, err
+	}
+
+	// Only reported after the password matched, so it does not reveal anything to guessers
+	if u.DisabledAt != nil {
+		s.recordSignIn(ctx, u.ID, u.Email, client, false, "disabled")
+		return Tokens{}, ErrAccountDisabled
+	}
+
+	tokens, err := s.startSession(ctx, u, client, mfaLevelPassword)
+	if err != nil {
+		return Tokens{}, err
 	}
+	s.recordSignIn(ctx, u.ID, u.Email, client, true, "")
+	return tokens, nil
+}
 
+func (s *AuthService) signAccessToken(u model.User, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
 		"sub": u.ID,
+		"sid": sessionID,
+		"role": u.Role,
 		"email": u.Email,
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
+		"exp": time.Now().Add(accessTokenTTL).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -59,6 +199,31 @@ func (s *AuthService) Login(ctx context.Context, email, password string) (string
 	return signed, nil
 }
 
+func (s *AuthService) loginFailed(ctx context.Context, ipKey, accountKey string, u model.User) {
+	if _, _, err := s.loginIP.Fail(ctx, ipKey); err != nil {
+		log.Println("login throttle:", err)
+	}
+
+	locked, until, err := s.loginAccount.Fail(ctx, accountKey)
+	if err != nil {
+		log.Println("login throttle:", err)
+		return
+	}
+	if !locked || u.ID == "" {
+		return
+	}
+
+	body := fmt.Sprintf("Your account was locked until %s after repeated failed sign-in attempts. "+
+		"If this was not you, consider changing your password.", until.UTC().Format(time.RFC1123))
+	if err := s.notifier.Notify(ctx, u.Email, "Account temporarily locked", body); err != nil {
+		log.Println("lockout notification:", err)
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 func IsNoRows(err error) bool {
 	return errors.Is(err, sql.ErrNoRows)
 }
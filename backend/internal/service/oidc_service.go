@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oidc"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
+)
+
+const (
+	// OIDCStateTTL is how long a started login or link may take at the provider
+	OIDCStateTTL = 10 * time.Minute
+
+	mfaLevelExternalOIDC = "oidc"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	ErrEmailNotLinked   = errors.New("an account with this email exists, sign in and link the provider from your settings")
+	ErrIdentityInUse    = errors.New("this external account is linked to another user")
+	ErrLastLoginMethod  = errors.New("cannot unlink the only way to sign in, set a password first")
+	ErrEmailNotVerified = errors.New("identity provider did not verify the email address")
+)
+
+// OIDCResult is the outcome of a callback: a new session or a linked identity
+type OIDCResult struct {
+	Tokens   Tokens
+	Linked   bool
+	Provider string
+}
+
+type OIDCService struct {
+	providers  map[string]*oidc.Provider
+	identities *repo.IdentityRepo
+	users      *repo.UserRepo
+	auth       *AuthService
+}
+
+func NewOIDCService(providers []*oidc.Provider, identities *repo.IdentityRepo, users *repo.UserRepo, auth *AuthService) *OIDCService {
+	m := make(map[string]*oidc.Provider, len(providers))
+	for _, p := range providers {
+		m[p.Name] = p
+	}
+	return &OIDCService{
+		providers:  m,
+		identities: identities,
+		users:      users,
+		auth:       auth,
+	}
+}
+
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Start begins a login (linkUserID empty) or a link of the provider to linkUserID. It returns
+// the authorization URL and the state, which the caller binds to the browser.
+func (s *OIDCService) Start(ctx context.Context, provider, linkUserID string) (string, string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := randomURLSafe(24)
+	if err != nil {
+		return "", "", fmt.Errorf("state: %w", err)
+	}
+	nonce, err := randomURLSafe(24)
+	if err != nil {
+		return "", "", fmt.Errorf("nonce: %w", err)
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", fmt.Errorf("pkce: %w", err)
+	}
+
+	authURL, err := p.AuthURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	pending := repo.OIDCState{Provider: provider, CodeVerifier: verifier, Nonce: nonce, LinkUserID: linkUserID}
+	if err := s.identities.SaveState(ctx, state, pending, time.Now().Add(OIDCStateTTL)); err != nil {
+		return "", "", fmt.Errorf("save oidc state: %w", err)
+	}
+	return authURL, state, nil
+}
+
+func (s *OIDCService) Callback(ctx context.Context, provider, state, code string, client ClientInfo) (OIDCResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return OIDCResult{}, ErrUnknownProvider
+	}
+
+	pending, err := s.identities.TakeState(ctx, state)
+	if IsNoRows(err) || (err == nil && pending.Provider != provider) {
+		return OIDCResult{}, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return OIDCResult{}, err
+	}
+
+	rawIDToken, err := p.Exchange(ctx, code, pending.CodeVerifier)
+	if err != nil {
+		return OIDCResult{}, fmt.Errorf("exchange code: %w", err)
+	}
+	claims, err := p.Verify(ctx, rawIDToken, pending.Nonce)
+	if err != nil {
+		return OIDCResult{}, err
+	}
+
+	linkedUserID, err := s.identities.FindUser(ctx, provider, claims.Subject)
+	if err != nil && !IsNoRows(err) {
+		return OIDCResult{}, err
+	}
+
+	// Linking from account settings
+	if pending.LinkUserID != "" {
+		if linkedUserID != "" && linkedUserID != pending.LinkUserID {
+			return OIDCResult{}, ErrIdentityInUse
+		}
+		if linkedUserID == "" {
+			if err := s.identities.Link(ctx, pending.LinkUserID, provider, claims.Subject, claims.Email); err != nil {
+				return OIDCResult{}, fmt.Errorf("link identity: %w", err)
+			}
+			recordAudit(ctx, s.auth.audit, audit.Event{
+				ActorID:      pending.LinkUserID,
+				Action:       "auth.identity.link",
+				TargetUserID: pending.LinkUserID,
+				Details:      map[string]any{"provider": provider},
+			})
+		}
+		return OIDCResult{Linked: true, Provider: provider}, nil
+	}
+
+	// Returning user
+	if linkedUserID != "" {
+		u, err := s.users.GetByID(ctx, linkedUserID)
+		if err != nil {
+			return OIDCResult{}, err
+		}
+		if u.DisabledAt != nil {
+			s.auth.recordSignIn(ctx, u.ID, u.Email, client, false, "disabled")
+			return OIDCResult{}, ErrAccountDisabled
+		}
+		tokens, err := s.auth.startSession(ctx, u, client, mfaLevelExternalOIDC)
+		if err != nil {
+			return OIDCResult{}, err
+		}
+		s.auth.recordSignIn(ctx, u.ID, u.Email, client, true, "oidc:"+provider)
+		return OIDCResult{Tokens: tokens, Provider: provider}, nil
+	}
+
+	// New user. Never auto-link to an existing email: the provider could be lying about ownership.
+	if claims.Email == "" || !claims.EmailVerified {
+		return OIDCResult{}, ErrEmailNotVerified
+	}
+	_, err = s.users.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		return OIDCResult{}, ErrEmailNotLinked
+	}
+	if !IsNoRows(err) {
+		return OIDCResult{}, err
+	}
+
+	u, err := s.users.CreateExternalUser(ctx, claims.Email, true, claims.Name)
+	if err != nil {
+		return OIDCResult{}, fmt.Errorf("create user: %w", err)
+	}
+	if err := s.identities.Link(ctx, u.ID, provider, claims.Subject, claims.Email); err != nil {
+		return OIDCResult{}, fmt.Errorf("link identity: %w", err)
+	}
+
+	tokens, err := s.auth.startSession(ctx, u, client, mfaLevelExternalOIDC)
+	if err != nil {
+		return OIDCResult{}, err
+	}
+	s.auth.recordSignIn(ctx, u.ID, u.Email, client, true, "oidc:"+provider)
+	return OIDCResult{Tokens: tokens, Provider: provider}, nil
+}
+
+func (s *OIDCService) Identities(ctx context.Context, userID string) ([]model.Identity, error) {
+	return s.identities.ListByUser(ctx, userID)
+}
+
+func (s *OIDCService) Unlink(ctx context.Context, userID, provider string) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ids, err := s.identities.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.PasswordHash == "" && len(ids) <= 1 {
+		return ErrLastLoginMethod
+	}
+	if err := s.identities.Unlink(ctx, userID, provider); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, s.auth.audit, audit.Event{
+		ActorID:      userID,
+		Action:       "auth.identity.unlink",
+		TargetUserID: userID,
+		Details:      map[string]any{"provider": provider},
+	})
+	return nil
+}
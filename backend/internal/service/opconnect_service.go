@@ -2,56 +2,99 @@ package service
 
 import (
 	"context"
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/url"
 	"time"
 
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/opclient"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/opjwt"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oprecord"
 	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
 )
 
+var ErrUnknownOPEnvironment = errors.New("unknown OP environment")
+
+// OPEnvironment is one OP deployment (sandbox, production) with its own client and credentials
+type OPEnvironment struct {
+	Name         string
+	Client       *opclient.AISClient
+	AuthBase     string
+	RedirectURI  string
+	ClientID     string
+	Aud          string
+	QSEAL        crypto.Signer // file key (hot-reloaded), PKCS#11 token or remote signer
+	QSEALAlg     string        // RS256 | PS256 | ES256 | ES384
+	QSEALKid     string
+}
+
 type OPConnectService struct {
-	op          *opclient.AISClient
-	repo        *repo.OPConnectRepo
-	authBase    string
-	redirectURI string
-	clientID    string
-	aud         string
-	qsealKey    *rsa.PrivateKey
-	qsealKid    string
+	envs       map[string]OPEnvironment
+	defaultEnv string
+	repo       *repo.OPConnectRepo
+	audit      *audit.Recorder
 }
 
+// NewOPConnectService serves the given environments; the first one is the default
 func NewOPConnectService(
-	op *opclient.AISClient,
+	envs []OPEnvironment,
 	repo *repo.OPConnectRepo,
-	authBase, redirectURI, clientID, aud, qsealKeyPath, qsealKid string,
+	recorder *audit.Recorder,
 ) (*OPConnectService, error) {
-	priv, err := opjwt.LoadRSAPrivateKeyFromPEM(qsealKeyPath)
+	if len(envs) == 0 {
+		return nil, errors.New("no OP environment")
+	}
+	s := &OPConnectService{
+		envs:       make(map[string]OPEnvironment, len(envs)),
+		defaultEnv: envs[0].Name,
+		repo:       repo,
+		audit:      recorder,
+	}
+	for _, e := range envs {
+		s.envs[e.Name] = e
+	}
+	return s, nil
+}
+
+// environment resolves a name; empty means the default (also used by connections made
+// before environments were recorded)
+func (s *OPConnectService) environment(name string) (OPEnvironment, error) {
+	if name == "" {
+		name = s.defaultEnv
+	}
+	e, ok := s.envs[name]
+	if !ok {
+		return OPEnvironment{}, ErrUnknownOPEnvironment
+	}
+	return e, nil
+}
+
+// Client returns the AIS client of an environment
+func (s *OPConnectService) Client(name string) (*opclient.AISClient, error) {
+	e, err := s.environment(name)
 	if err != nil {
 		return nil, err
 	}
-	return &OPConnectService{
-		op:          op,
-		repo:        repo,
-		authBase:    authBase,
-		redirectURI: redirectURI,
-		clientID:    clientID,
-		aud:         aud,
-		qsealKey:    priv,
-		qsealKid:    qsealKid,
-	}, nil
+	return e.Client, nil
 }
 
-func (s *OPConnectService) Start(ctx context.Context, userID string) (string, error) {
+func (s *OPConnectService) Start(ctx context.Context, userID, envName string) (string, error) {
+	env, err := s.environment(envName)
+	if err != nil {
+		return "", err
+	}
+	// Recorded OP calls can be looked up by user
+	ctx = oprecord.WithUser(ctx, userID)
+
 	// Client credentials token
 	tctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	ccToken, err := s.op.ClientCredentialsToken(tctx)
+	ccToken, err := env.Client.ClientCredentialsToken(tctx)
 	if err != nil {
 		return "", fmt.Errorf("client credentials token: %w", err)
 	}
@@ -60,7 +103,7 @@ func (s *OPConnectService) Start(ctx context.Context, userID string) (string, er
 	actx, cancel2 := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel2()
 
-	authorizationID, err := s.op.CreateAuthorization(actx, ccToken)
+	authorizationID, err := env.Client.CreateAuthorization(actx, ccToken)
 	if err != nil {
 		return "", fmt.Errorf("create authorization: %w", err)
 	}
@@ -75,12 +118,12 @@ func (s *OPConnectService) Start(ctx context.Context, userID string) (string, er
 		return "", fmt.Errorf("nonce: %w", err)
 	}
 
-	// Sign OP request JWT (using TPP QSEAL RS256 algo)
-	requestJWT, err := opjwt.SignOPRequestJWT(s.qsealKey, s.qsealKid, opjwt.RequestClaims{
-		Aud:            s.aud,
-		Iss:            s.clientID,
-		ClientID:       s.clientID,
-		RedirectURI:    s.redirectURI,
+	// Sign OP request JWT with the TPP QSEAL
+	requestJWT, err := opjwt.SignOPRequestJWT(env.QSEAL, env.QSEALAlg, env.QSEALKid, opjwt.RequestClaims{
+		Aud:            env.Aud,
+		Iss:            env.ClientID,
+		ClientID:       env.ClientID,
+		RedirectURI:    env.RedirectURI,
 		Scope:          "openid accounts",
 		State:          state,
 		Nonce:          nonce,
@@ -94,16 +137,27 @@ func (s *OPConnectService) Start(ctx context.Context, userID string) (string, er
 	sctx, cancel3 := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel3()
 
-	if err := s.repo.SavePending(sctx, state, userID, authorizationID, nonce); err != nil {
+	if err := s.repo.SavePending(sctx, state, userID, authorizationID, nonce, env.Name); err != nil {
 		return "", fmt.Errorf("save pending authorization: %w", err)
 	}
 
+	// Consent trail is mandatory: no audit row, no redirect to the bank
+	err = s.audit.Record(ctx, audit.Event{
+		ActorID:      userID,
+		Action:       "opconnect.authorization.create",
+		TargetUserID: userID,
+		Details:      map[string]any{"authorizationId": authorizationID, "environment": env.Name},
+	})
+	if err != nil {
+		return "", fmt.Errorf("audit authorization: %w", err)
+	}
+
 	// Build redirect URL
-	u, _ := url.Parse(s.authBase + "/oauth/authorize")
+	u, _ := url.Parse(env.AuthBase + "/oauth/authorize")
 	q := u.Query()
 	q.Set("request", requestJWT)
 	q.Set("response_type", "code")
-	q.Set("client_id", s.clientID)
+	q.Set("client_id", env.ClientID)
 	q.Set("scope", "openid accounts")
 	u.RawQuery = q.Encode()
 
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+const passwordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ChangePassword requires the current password. Wrong guesses count against the account limiter.
+// Every other session of the user is signed out; sessionID, the caller's, stays.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, sessionID, current, next string) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ConfirmPassword(ctx, u, current); err != nil {
+		return err
+	}
+
+	if err := s.policy.Check(ctx, next, u.Email); err != nil {
+		return err
+	}
+	if err := s.setPassword(ctx, u.ID, next); err != nil {
+		return err
+	}
+	if err := s.sessions.RevokeOthers(ctx, u.ID, sessionID); err != nil {
+		return fmt.Errorf("revoke other sessions: %w", err)
+	}
+	recordAudit(ctx, s.audit, audit.Event{ActorID: u.ID, Action: "auth.password.change", TargetUserID: u.ID})
+
+	if err := s.notifier.Notify(ctx, u.Email, "Password changed", "The password of your account was changed."); err != nil {
+		log.Println("password change notification:", err)
+	}
+	return nil
+}
+
+// ConfirmPassword checks the password of a signed-in user before a sensitive change. Wrong
+// guesses count against the same account limiter as logins.
+func (s *AuthService) ConfirmPassword(ctx context.Context, u model.User, password string) error {
+	accountKey := "login-account:" + normalizeEmail(u.Email)
+	if err := s.loginAccount.Attempt(ctx, accountKey); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		if _, _, err := s.loginAccount.Fail(ctx, accountKey); err != nil {
+			log.Println("password confirmation throttle:", err)
+		}
+		return ErrInvalidCredentials
+	}
+	return s.loginAccount.Succeed(ctx, accountKey)
+}
+
+// RequestPasswordReset mails a one-time token. Unknown emails succeed silently (no enumeration).
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email, clientIP string) error {
+	ipKey := "reset-ip:" + clientIP
+	// Every request counts, found or not
+	if err := s.resetIP.Attempt(ctx, ipKey); err != nil {
+		return err
+	}
+
+	u, err := s.users.GetByEmail(ctx, email)
+	if IsNoRows(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := randomURLSafe(32)
+	if err != nil {
+		return fmt.Errorf("reset token: %w", err)
+	}
+	if err := s.resets.Create(ctx, hashToken(token), u.ID, time.Now().Add(passwordResetTTL)); err != nil {
+		return fmt.Errorf("save reset token: %w", err)
+	}
+
+	body := "Use this token to reset your password within one hour: " + token
+	return s.notifier.Notify(ctx, u.Email, "Password reset", body)
+}
+
+func (s *AuthService) ResetPassword(ctx context.Context, token, next string) error {
+	tokenHash := hashToken(token)
+
+	userID, err := s.resets.Lookup(ctx, tokenHash)
+	if IsNoRows(err) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Check the policy before using up the token so the user can retry with a better password
+	if err := s.policy.Check(ctx, next, u.Email); err != nil {
+		return err
+	}
+	if _, err := s.resets.Consume(ctx, tokenHash); err != nil {
+		if IsNoRows(err) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if err := s.setPassword(ctx, u.ID, next); err != nil {
+		return err
+	}
+
+	// Whoever triggered the reset may not be the only one holding sessions
+	if err := s.sessions.RevokeAll(ctx, u.ID); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	recordAudit(ctx, s.audit, audit.Event{ActorID: u.ID, Action: "auth.password.reset", TargetUserID: u.ID})
+	return s.loginAccount.Reset(ctx, "login-account:"+normalizeEmail(u.Email))
+}
+
+func (s *AuthService) setPassword(ctx context.Context, userID, next string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(next), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.users.UpdatePassword(ctx, userID, string(hash))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,379 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/notify"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/oprecord"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/tracing"
+)
+
+const (
+	exportLinkTTL  = 24 * time.Hour
+	exportBuildTTL = 5 * time.Minute
+	// Accounts without a password confirm erasure from a session at most this old
+	erasureSignInWindow = 10 * time.Minute
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found or expired")
+	ErrSignInRequired = errors.New("sign in again to confirm")
+)
+
+// PrivacyService implements the GDPR rights: data export (Art. 20) and erasure (Art. 17)
+type PrivacyService struct {
+	users      *repo.UserRepo
+	sessions   *repo.SessionRepo
+	signIns    *repo.SignInEventRepo
+	identities *repo.IdentityRepo
+	opRepo     *repo.OPConnectRepo
+	exports    *repo.ExportRepo
+	audit      *audit.Recorder
+	op         *OPConnectService
+	opCalls    oprecord.Store // nil unless OP_RECORDER is on
+	notifier   notify.Notifier
+	auth       *AuthService // password confirmation
+
+	exportDir     string
+	publicBaseURL string
+
+	// Running export builds, waited for on shutdown
+	wg sync.WaitGroup
+}
+
+func NewPrivacyService(
+	users *repo.UserRepo,
+	sessions *repo.SessionRepo,
+	signIns *repo.SignInEventRepo,
+	identities *repo.IdentityRepo,
+	opRepo *repo.OPConnectRepo,
+	exports *repo.ExportRepo,
+	recorder *audit.Recorder,
+	op *OPConnectService,
+	opCalls oprecord.Store,
+	notifier notify.Notifier,
+	auth *AuthService,
+	exportDir, publicBaseURL string,
+) (*PrivacyService, error) {
+	if err := os.MkdirAll(exportDir, 0o700); err != nil {
+		return nil, fmt.Errorf("export dir: %w", err)
+	}
+	return &PrivacyService{
+		users:         users,
+		sessions:      sessions,
+		signIns:       signIns,
+		identities:    identities,
+		opRepo:        opRepo,
+		exports:       exports,
+		audit:         recorder,
+		op:            op,
+		opCalls:       opCalls,
+		auth:          auth,
+		notifier:      notifier,
+		exportDir:     exportDir,
+		publicBaseURL: publicBaseURL,
+	}, nil
+}
+
+// RequestExport queues an export; the archive is built in the background and the link mailed
+func (s *PrivacyService) RequestExport(ctx context.Context, userID string) (model.DataExport, error) {
+	s.removeExpired(ctx)
+
+	e, err := s.exports.Create(ctx, userID)
+	if err != nil {
+		return model.DataExport{}, err
+	}
+	recordAudit(ctx, s.audit, audit.Event{ActorID: userID, Action: "privacy.export.request", TargetUserID: userID})
+
+	requestSpan := trace.SpanContextFromContext(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		bctx, cancel := context.WithTimeout(context.Background(), exportBuildTTL)
+		defer cancel()
+
+		// Own trace: the job outlives the request, so it only links to it
+		bctx, span := tracing.Start(bctx, "privacy.export.build",
+			trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: requestSpan}),
+			trace.WithAttributes(attribute.String("export.id", e.ID)))
+		defer span.End()
+
+		if err := s.buildExport(bctx, e); err != nil {
+			tracing.SetError(span, err)
+			log.Printf("export %s: %v", e.ID, err)
+			if err := s.exports.MarkFailed(bctx, e.ID); err != nil {
+				log.Printf("export %s mark failed: %v", e.ID, err)
+			}
+		}
+	}()
+	return e, nil
+}
+
+// Wait blocks until running export builds finish or ctx ends (graceful shutdown)
+func (s *PrivacyService) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *PrivacyService) ExportStatus(ctx context.Context, userID, exportID string) (model.DataExport, error) {
+	e, err := s.exports.Get(ctx, exportID, userID)
+	if IsNoRows(err) {
+		return model.DataExport{}, ErrExportNotFound
+	}
+	return e, err
+}
+
+// ExportFile resolves a download token to the archive path
+func (s *PrivacyService) ExportFile(ctx context.Context, token string) (string, error) {
+	e, err := s.exports.ByToken(ctx, hashToken(token))
+	if IsNoRows(err) {
+		return "", ErrExportNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	recordAudit(ctx, s.audit, audit.Event{ActorID: e.UserID, Action: "privacy.export.download", TargetUserID: e.UserID})
+	return e.FilePath, nil
+}
+
+// DeleteAccount revokes every bank consent at the ASPSP, then erases the user's data
+// in one transaction. Nothing is deleted if a consent cannot be revoked.
+func (s *PrivacyService) DeleteAccount(ctx context.Context, userID, sessionID, password string) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.confirmErasure(ctx, u, sessionID, password); err != nil {
+		return err
+	}
+
+	conns, err := s.opRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ctx = oprecord.WithUser(ctx, userID)
+	// One client credentials token per OP environment the user has consents in
+	ccTokens := make(map[string]string)
+	for _, c := range conns {
+		client, err := s.op.Client(c.Environment)
+		if err != nil {
+			return fmt.Errorf("revoke consent %s: environment %q: %w", c.AuthorizationID, c.Environment, err)
+		}
+		ccToken, ok := ccTokens[c.Environment]
+		if !ok {
+			if ccToken, err = client.ClientCredentialsToken(ctx); err != nil {
+				return fmt.Errorf("client credentials token: %w", err)
+			}
+			ccTokens[c.Environment] = ccToken
+		}
+		if err := client.RevokeAuthorization(ctx, ccToken, c.AuthorizationID); err != nil {
+			return fmt.Errorf("revoke consent %s: %w", c.AuthorizationID, err)
+		}
+	}
+
+	files, err := s.exports.FilesOf(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.users.DeleteAccount(ctx, userID, u.Email); err != nil {
+		return fmt.Errorf("delete account: %w", err)
+	}
+	for _, f := range files {
+		_ = os.Remove(f)
+	}
+	// Recorded OP calls hold the user's bank data, including the revocations just made
+	if s.opCalls != nil {
+		if err := s.opCalls.DeleteUser(ctx, userID); err != nil {
+			log.Printf("delete account %s: recorded OP calls: %v", userID, err)
+		}
+	}
+
+	// Only the pseudonymous id stays in the audit trail. The account is gone by now, so a
+	// failure here must not be reported as a failed deletion.
+	recordAudit(ctx, s.audit, audit.Event{
+		ActorID:      userID,
+		Action:       "privacy.account.delete",
+		TargetUserID: userID,
+		Details:      map[string]any{"consentsRevoked": len(conns)},
+	})
+	return nil
+}
+
+// confirmErasure checks the password, throttled like logins, or for identity-provider-only
+// accounts, which have none, that the calling session was signed in with the provider just now
+func (s *PrivacyService) confirmErasure(ctx context.Context, u model.User, sessionID, password string) error {
+	if u.PasswordHash != "" {
+		return s.auth.ConfirmPassword(ctx, u, password)
+	}
+	signedInAt, err := s.sessions.SignedInAt(ctx, sessionID, u.ID)
+	if IsNoRows(err) || (err == nil && time.Since(signedInAt) > erasureSignInWindow) {
+		return ErrSignInRequired
+	}
+	return err
+}
+
+func (s *PrivacyService) buildExport(ctx context.Context, e model.DataExport) error {
+	u, err := s.users.GetByID(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	conns, err := s.opRepo.ListByUser(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	sessions, err := s.sessions.ListAll(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	signIns, err := s.signIns.ListByUser(ctx, e.UserID, 10000)
+	if err != nil {
+		return err
+	}
+	ids, err := s.identities.ListByUser(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	events, err := s.audit.ListForUser(ctx, e.UserID, 10000)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.exportDir, e.ID+".zip")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+
+	datasets := []dataset{
+		{"profile", u, [][]string{
+			{"id", "email", "email_verified", "display_name", "locale", "preferred_currency", "timezone", "created_at"},
+			{u.ID, u.Email, strconv.FormatBool(u.EmailVerified), u.DisplayName, u.Locale, u.PreferredCurrency, u.Timezone, ts(u.CreatedAt)},
+		}},
+		{"connections", conns, rowsOf([]string{"authorization_id", "environment", "status", "created_at", "updated_at"}, conns,
+			func(c model.Connection) []string {
+				return []string{c.AuthorizationID, c.Environment, c.Status, ts(c.CreatedAt), ts(c.UpdatedAt)}
+			})},
+		{"sessions", sessions, rowsOf([]string{"id", "ip", "user_agent", "mfa_level", "created_at", "last_seen_at", "expires_at"}, sessions,
+			func(s model.Session) []string {
+				return []string{s.ID, s.IP, s.UserAgent, s.MFALevel, ts(s.CreatedAt), ts(s.LastSeenAt), ts(s.ExpiresAt)}
+			})},
+		{"sign_ins", signIns, rowsOf([]string{"email", "ip", "user_agent", "success", "reason", "created_at"}, signIns,
+			func(e model.SignInEvent) []string {
+				return []string{e.Email, e.IP, e.UserAgent, strconv.FormatBool(e.Success), e.Reason, ts(e.CreatedAt)}
+			})},
+		{"identities", ids, rowsOf([]string{"provider", "email", "created_at"}, ids,
+			func(i model.Identity) []string {
+				return []string{i.Provider, i.Email, ts(i.CreatedAt)}
+			})},
+		{"audit_events", events, rowsOf([]string{"id", "action", "ip", "details", "created_at"}, events,
+			func(a audit.Entry) []string {
+				return []string{strconv.FormatInt(a.ID, 10), a.Action, a.IP, a.Details, ts(a.CreatedAt)}
+			})},
+	}
+	for _, d := range datasets {
+		if err := d.write(zw); err != nil {
+			f.Close()
+			return fmt.Errorf("write %s: %w", d.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	token, err := randomURLSafe(32)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(exportLinkTTL)
+	if err := s.exports.MarkReady(ctx, e.ID, path, hashToken(token), expires); err != nil {
+		return err
+	}
+
+	link := s.publicBaseURL + "/exports/" + token
+	body := "Your data export is ready. Download it before " + expires.UTC().Format(time.RFC1123) + ": " + link
+	return s.notifier.Notify(ctx, u.Email, "Your data export", body)
+}
+
+func (s *PrivacyService) removeExpired(ctx context.Context) {
+	files, err := s.exports.DeleteExpired(ctx)
+	if err != nil {
+		log.Println("remove expired exports:", err)
+		return
+	}
+	for _, f := range files {
+		_ = os.Remove(f)
+	}
+}
+
+// dataset is written as <name>.json and <name>.csv in the archive
+type dataset struct {
+	name string
+	json any
+	csv  [][]string
+}
+
+func (d dataset) write(zw *zip.Writer) error {
+	jw, err := zw.Create(d.name + ".json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(jw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d.json); err != nil {
+		return err
+	}
+
+	cw, err := zw.Create(d.name + ".csv")
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(cw)
+	if err := w.WriteAll(d.csv); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+func rowsOf[T any](header []string, items []T, row func(T) []string) [][]string {
+	out := [][]string{header}
+	for _, it := range items {
+		out = append(out, row(it))
+	}
+	return out
+}
+
+func ts(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
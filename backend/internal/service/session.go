@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	mfaLevelPassword = "password"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+)
+
+// Tokens is what a successful login or refresh hands to the client
+type Tokens struct {
+	AccessToken      string
+	RefreshToken     string
+	ExpiresIn        int // access token lifetime in seconds
+	RefreshExpiresIn int // refresh token lifetime in seconds, for the refresh cookie
+	SessionID        string
+}
+
+func (s *AuthService) startSession(ctx context.Context, u model.User, client ClientInfo, mfaLevel string) (Tokens, error) {
+	refresh, err := randomURLSafe(32)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("refresh token: %w", err)
+	}
+
+	sessionID, err := s.sessions.Create(ctx, u.ID, hashToken(refresh), client.IP, client.UserAgent, mfaLevel, time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return Tokens{}, fmt.Errorf("create session: %w", err)
+	}
+
+	access, err := s.signAccessToken(u, sessionID)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		ExpiresIn:        int(accessTokenTTL.Seconds()),
+		RefreshExpiresIn: int(refreshTokenTTL.Seconds()),
+		SessionID:        sessionID,
+	}, nil
+}
+
+// Refresh rotates the refresh token and issues a new access token for the same session
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client ClientInfo) (Tokens, error) {
+	next, err := randomURLSafe(32)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("refresh token: %w", err)
+	}
+
+	sessionID, userID, err := s.sessions.Rotate(ctx, hashToken(refreshToken), hashToken(next), client.IP, client.UserAgent)
+	if IsNoRows(err) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if u.DisabledAt != nil {
+		return Tokens{}, ErrAccountDisabled
+	}
+	access, err := s.signAccessToken(u, sessionID)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:      access,
+		RefreshToken:     next,
+		ExpiresIn:        int(accessTokenTTL.Seconds()),
+		RefreshExpiresIn: int(refreshTokenTTL.Seconds()),
+		SessionID:        sessionID,
+	}, nil
+}
+
+// SessionActive is used by the JWT middleware to reject tokens of revoked sessions
+func (s *AuthService) SessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	return s.sessions.Active(ctx, sessionID, userID)
+}
+
+// ListSessions returns the active sessions of a user, flagging the one making the request
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentSessionID string) ([]model.Session, error) {
+	sessions, err := s.sessions.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession returns sql.ErrNoRows (check with IsNoRows) for unknown sessions
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if err := s.sessions.Revoke(ctx, sessionID, userID); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, s.audit, audit.Event{
+		ActorID:      userID,
+		Action:       "auth.session.revoke",
+		TargetUserID: userID,
+		Details:      map[string]any{"sessionId": sessionID},
+	})
+	return nil
+}
+
+// Logout revokes the session of a refresh token, which stays usable after the access token
+// has expired. Returns ErrInvalidRefreshToken for unknown or already revoked tokens.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	sessionID, userID, err := s.sessions.RevokeByRefresh(ctx, hashToken(refreshToken))
+	if IsNoRows(err) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	recordAudit(ctx, s.audit, audit.Event{
+		ActorID:      userID,
+		Action:       "auth.session.revoke",
+		TargetUserID: userID,
+		Details:      map[string]any{"sessionId": sessionID},
+	})
+	return nil
+}
+
+// RefreshExpiresIn is the refresh token lifetime in seconds
+func (s *AuthService) RefreshExpiresIn() int {
+	return int(refreshTokenTTL.Seconds())
+}
+
+// recordSignIn feeds the sign-in history and, for known users, the audit log
+func (s *AuthService) recordSignIn(ctx context.Context, userID, email string, client ClientInfo, success bool, reason string) {
+	if err := s.signIns.Record(ctx, userID, email, client.IP, client.UserAgent, success, reason); err != nil {
+		log.Println("record sign-in event:", err)
+	}
+	if userID == "" {
+		return
+	}
+
+	action := "auth.login.success"
+	if !success {
+		action = "auth.login.failure"
+	}
+	var details map[string]any
+	if reason != "" {
+		details = map[string]any{"reason": reason}
+	}
+	recordAudit(ctx, s.audit, audit.Event{ActorID: userID, Action: action, TargetUserID: userID, Details: details})
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+
+	"github.com/shahnajsc/OnePointLedger/backend/internal/audit"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/model"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/notify"
+	"github.com/shahnajsc/OnePointLedger/backend/internal/repo"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailTaken               = errors.New("email already registered")
+)
+
+// FieldError reports an invalid input field with a machine-readable reason
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+type UserService struct {
+	users         *repo.UserRepo
+	verifications *repo.EmailVerificationRepo
+	notifier      notify.Notifier
+	audit         *audit.Recorder
+	auth          *AuthService // password confirmation
+}
+
+func NewUserService(users *repo.UserRepo, verifications *repo.EmailVerificationRepo, notifier notify.Notifier, recorder *audit.Recorder, auth *AuthService) *UserService {
+	return &UserService{
+		users:         users,
+		verifications: verifications,
+		auth:          auth,
+		notifier:      notifier,
+		audit:         recorder,
+	}
+}
+
+func (s *UserService) Profile(ctx context.Context, userID string) (model.User, error) {
+	return s.users.GetByID(ctx, userID)
+}
+
+func (s *UserService) UpdateProfile(ctx context.Context, userID string, upd model.ProfileUpdate) (model.User, error) {
+	if err := normalizeProfile(&upd); err != nil {
+		return model.User{}, err
+	}
+	return s.users.UpdateProfile(ctx, userID, upd)
+}
+
+// SendVerification mails a one-time link proving the user owns email. Earlier links of the
+// user stop working, so an old one cannot bring back a superseded address.
+func (s *UserService) SendVerification(ctx context.Context, userID, email string) error {
+	token, err := randomURLSafe(32)
+	if err != nil {
+		return fmt.Errorf("verification token: %w", err)
+	}
+	if err := s.verifications.Create(ctx, hashToken(token), userID, email, time.Now().Add(emailVerificationTTL)); err != nil {
+		return fmt.Errorf("save verification token: %w", err)
+	}
+
+	body := "Confirm your email address with this token within 24 hours: " + token
+	return s.notifier.Notify(ctx, email, "Confirm your email address", body)
+}
+
+// RequestEmailChange keeps the current address until the new one is verified
+func (s *UserService) RequestEmailChange(ctx context.Context, userID, newEmail, password string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if !strings.Contains(newEmail, "@") {
+		return &FieldError{Field: "email", Reason: "invalid_email"}
+	}
+
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.auth.ConfirmPassword(ctx, u, password); err != nil {
+		return err
+	}
+	if normalizeEmail(newEmail) == normalizeEmail(u.Email) {
+		return &FieldError{Field: "email", Reason: "unchanged"}
+	}
+
+	_, err = s.users.GetByEmail(ctx, newEmail)
+	if err == nil {
+		return ErrEmailTaken
+	}
+	if !IsNoRows(err) {
+		return err
+	}
+
+	if err := s.SendVerification(ctx, u.ID, newEmail); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, audit.Event{ActorID: u.ID, Action: "user.email.change_requested", TargetUserID: u.ID})
+
+	// Old address learns about the change in case the account was taken over
+	body := "A change of your account email to " + newEmail + " was requested."
+	if err := s.notifier.Notify(ctx, u.Email, "Email change requested", body); err != nil {
+		log.Println("email change notification:", err)
+	}
+	return nil
+}
+
+// VerifyEmail confirms signup addresses and completes email changes
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	userID, email, err := s.verifications.Consume(ctx, hashToken(token))
+	if IsNoRows(err) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetVerifiedEmail(ctx, userID, email); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, s.audit, audit.Event{ActorID: userID, Action: "user.email.verified", TargetUserID: userID})
+	return nil
+}
+
+// Activity is the user's own security and consent history (/me/activity)
+func (s *UserService) Activity(ctx context.Context, userID string, limit int) ([]model.ActivityEvent, error) {
+	entries, err := s.audit.ListForUser(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.ActivityEvent, 0, len(entries))
+	for _, e := range entries {
+		ev := model.ActivityEvent{ID: e.ID, Action: e.Action, CreatedAt: e.CreatedAt}
+		// Staff identity and IP are not shown to the user, only that staff acted
+		if e.ActorID == userID {
+			ev.IP = e.IP
+		} else {
+			ev.ByStaff = true
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+func normalizeProfile(upd *model.ProfileUpdate) error {
+	if upd.DisplayName != nil {
+		name := strings.TrimSpace(*upd.DisplayName)
+		if utf8.RuneCountInString(name) > 100 {
+			return &FieldError{Field: "displayName", Reason: "too_long"}
+		}
+		upd.DisplayName = &name
+	}
+
+	if upd.Locale != nil {
+		tag, err := language.Parse(*upd.Locale)
+		if err != nil {
+			return &FieldError{Field: "locale", Reason: "unknown_locale"}
+		}
+		locale := tag.String()
+		upd.Locale = &locale
+	}
+
+	if upd.PreferredCurrency != nil {
+		unit, err := currency.ParseISO(*upd.PreferredCurrency)
+		if err != nil {
+			return &FieldError{Field: "preferredCurrency", Reason: "unknown_currency"}
+		}
+		code := unit.String()
+		upd.PreferredCurrency = &code
+	}
+
+	if upd.Timezone != nil {
+		tz := *upd.Timezone
+		if tz == "" || tz == "Local" {
+			return &FieldError{Field: "timezone", Reason: "unknown_timezone"}
+		}
+		if _, err := time.LoadLocation(tz); err != nil {
+			return &FieldError{Field: "timezone", Reason: "unknown_timezone"}
+		}
+	}
+	return nil
+}
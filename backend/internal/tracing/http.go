@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span per request, continuing a traceparent sent by the frontend.
+// otelhttp names the span after the matched ServeMux pattern once routing has happened.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server")
+}
+
+// NewTransport traces outbound calls, naming spans after peer (e.g. "OP"). Trace context is
+// not forwarded: the bank has no use for it.
+func NewTransport(base http.RoundTripper, peer string) http.RoundTripper {
+	return otelhttp.NewTransport(interactionID{base},
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator()),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return peer + " " + r.Method + " " + r.URL.Path
+		}))
+}
+
+// interactionID records the x-fapi-interaction-id OP echoes or assigns, the key for support
+// requests to the bank, on the client span
+type interactionID struct {
+	base http.RoundTripper
+}
+
+func (t interactionID) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if id := resp.Header.Get("x-fapi-interaction-id"); id != "" {
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.String("op.interaction_id", id))
+	}
+	return resp, nil
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WrapConnector traces every query and exec made through database/sql
+func WrapConnector(c driver.Connector) driver.Connector {
+	return &tracedConnector{base: c}
+}
+
+type tracedConnector struct {
+	base driver.Connector
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+func (c *tracedConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// tracedConn forwards the optional driver interfaces pgx implements
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuery(ctx, "db.exec", query)
+	defer span.End()
+
+	res, err := execer.ExecContext(ctx, query, args)
+	SetError(span, err)
+	return res, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuery(ctx, "db.query", query)
+	defer span.End()
+
+	rows, err := queryer.QueryContext(ctx, query, args)
+	SetError(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck // fallback for drivers without BeginTx
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *tracedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// startQuery names the span after the SQL verb and table-ish first line, keeping values out
+func startQuery(ctx context.Context, op, query string) (context.Context, trace.Span) {
+	stmt := strings.Join(strings.Fields(query), " ")
+	if verb, _, ok := strings.Cut(stmt, " "); ok {
+		op += " " + strings.ToUpper(verb)
+	}
+	return Start(ctx, op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNamePostgreSQL, semconv.DBQueryText(stmt)))
+}